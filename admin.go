@@ -0,0 +1,503 @@
+package mwclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// Watchlist is the value of the watchlist parameter of write actions, which
+// controls whether the page is added to or removed from the user's
+// watchlist.
+type Watchlist string
+
+// These consts are the values of Watchlist.
+const (
+	// WatchlistPreferences uses the user's preferences (the API's default).
+	WatchlistPreferences Watchlist = "preferences"
+	// WatchlistWatch adds the page to the watchlist.
+	WatchlistWatch Watchlist = "watch"
+	// WatchlistUnwatch removes the page from the watchlist.
+	WatchlistUnwatch Watchlist = "unwatch"
+	// WatchlistNoChange leaves the watchlist unchanged.
+	WatchlistNoChange Watchlist = "nochange"
+)
+
+// MoveOptions contains options for Move.
+// See https://www.mediawiki.org/wiki/API:Move
+type MoveOptions struct {
+	Reason string
+	// MoveTalk also moves the talk page, if it exists.
+	MoveTalk bool
+	// MoveSubpages also moves the subpages (and the subpages of the talk
+	// page, if MoveTalk is true), if applicable.
+	MoveSubpages bool
+	// NoRedirect suppresses the creation of a redirect from the old title.
+	// It requires the suppressredirect right.
+	NoRedirect bool
+	// IgnoreWarnings moves the page despite warnings.
+	IgnoreWarnings bool
+	Watchlist      Watchlist
+	// Tags are the change tags applied to the log entry and the null
+	// revision.
+	Tags []string
+}
+
+// MoveResult contains the information returned by the API about
+// a successful move.
+type MoveResult struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Reason string `json:"reason"`
+	// RedirectCreated is true if a redirect was created from the old title.
+	RedirectCreated bool `json:"redirectcreated"`
+	// MoveOverRedirect is true if the page was moved over an existing
+	// redirect.
+	MoveOverRedirect bool `json:"moveoverredirect"`
+	// TalkFrom and TalkTo are the old and new titles of the talk page
+	// if it was moved.
+	TalkFrom string `json:"talkfrom"`
+	TalkTo   string `json:"talkto"`
+	// Subpages and TalkSubpages are the subpages of the page and its talk
+	// page that were moved.
+	Subpages     []MovedPage `json:"subpages"`
+	TalkSubpages []MovedPage `json:"subpages-talk"`
+}
+
+// MovedPage is a subpage moved along with a page.
+type MovedPage struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Move moves the page with the title from to the title to.
+// If the move fails, an APIError is returned (e.g. with the code "cantmove",
+// "articleexists" or "protectedpage").
+func (w *Client) Move(from, to string, opts MoveOptions) (*MoveResult, error) {
+	return w.MoveContext(context.Background(), from, to, opts)
+}
+
+// MoveContext is like Move, but the requests are bound to ctx.
+func (w *Client) MoveContext(ctx context.Context, from, to string, opts MoveOptions) (*MoveResult, error) {
+	p := params.Values{
+		"action": "move",
+		"from":   from,
+		"to":     to,
+	}
+	setReasonTags(p, opts.Reason, opts.Tags)
+	setFlag(p, "movetalk", opts.MoveTalk)
+	setFlag(p, "movesubpages", opts.MoveSubpages)
+	setFlag(p, "noredirect", opts.NoRedirect)
+	setFlag(p, "ignorewarnings", opts.IgnoreWarnings)
+	setWatchlist(p, opts.Watchlist)
+
+	var result MoveResult
+	if err := w.writeAction(ctx, CSRFToken, p, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteOptions contains options for Delete.
+// See https://www.mediawiki.org/wiki/API:Delete
+type DeleteOptions struct {
+	Reason string
+	// DeleteTalk also deletes the talk page, if it exists.
+	DeleteTalk bool
+	Watchlist  Watchlist
+	// Tags are the change tags applied to the log entry.
+	Tags []string
+}
+
+// DeleteResult contains the information returned by the API about
+// a successful deletion.
+type DeleteResult struct {
+	Title  string `json:"title"`
+	Reason string `json:"reason"`
+	// LogID is the ID of the deletion log entry.
+	LogID int `json:"logid"`
+}
+
+// Delete deletes the page with the given title.
+// If the deletion fails, an APIError is returned (e.g. with the code
+// "missingtitle", "cantdelete" or "permissiondenied").
+func (w *Client) Delete(title string, opts DeleteOptions) (*DeleteResult, error) {
+	return w.DeleteContext(context.Background(), title, opts)
+}
+
+// DeleteContext is like Delete, but the requests are bound to ctx.
+func (w *Client) DeleteContext(ctx context.Context, title string, opts DeleteOptions) (*DeleteResult, error) {
+	p := params.Values{
+		"action": "delete",
+		"title":  title,
+	}
+	setReasonTags(p, opts.Reason, opts.Tags)
+	setFlag(p, "deletetalk", opts.DeleteTalk)
+	setWatchlist(p, opts.Watchlist)
+
+	var result DeleteResult
+	if err := w.writeAction(ctx, CSRFToken, p, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UndeleteOptions contains options for Undelete.
+// See https://www.mediawiki.org/wiki/API:Undelete
+type UndeleteOptions struct {
+	Reason string
+	// Timestamps are the timestamps of the revisions to restore.
+	// If Timestamps is empty, all deleted revisions are restored.
+	Timestamps []string
+	// UndeleteTalk also restores the deleted revisions of the talk page.
+	UndeleteTalk bool
+	Watchlist    Watchlist
+	// Tags are the change tags applied to the log entry.
+	Tags []string
+}
+
+// UndeleteResult contains the information returned by the API about
+// a successful undeletion.
+type UndeleteResult struct {
+	Title  string `json:"title"`
+	Reason string `json:"reason"`
+	// Revisions is the number of revisions restored.
+	Revisions int `json:"revisions"`
+	// FileVersions is the number of file versions restored.
+	FileVersions int `json:"fileversions"`
+}
+
+// Undelete restores the deleted revisions of the page with the given title.
+// If the undeletion fails, an APIError is returned (e.g. with the code
+// "cantundelete" or "permissiondenied").
+func (w *Client) Undelete(title string, opts UndeleteOptions) (*UndeleteResult, error) {
+	return w.UndeleteContext(context.Background(), title, opts)
+}
+
+// UndeleteContext is like Undelete, but the requests are bound to ctx.
+func (w *Client) UndeleteContext(ctx context.Context, title string, opts UndeleteOptions) (*UndeleteResult, error) {
+	p := params.Values{
+		"action": "undelete",
+		"title":  title,
+	}
+	setReasonTags(p, opts.Reason, opts.Tags)
+	if len(opts.Timestamps) > 0 {
+		p.AddRange("timestamps", opts.Timestamps...)
+	}
+	setFlag(p, "undeletetalk", opts.UndeleteTalk)
+	setWatchlist(p, opts.Watchlist)
+
+	var result UndeleteResult
+	if err := w.writeAction(ctx, CSRFToken, p, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Protection is the protection of a page against an action.
+type Protection struct {
+	// Type is the protected action, e.g. "edit", "move", "create" or
+	// "upload".
+	Type string
+	// Level is the user group allowed to perform the action, e.g.
+	// "autoconfirmed" or "sysop". An empty Level removes the protection.
+	Level string
+	// Expiry is the expiry of the protection as a timestamp or a relative
+	// time such as "1 week". An empty Expiry means "infinite".
+	Expiry string
+}
+
+// ProtectOptions contains options for Protect.
+// See https://www.mediawiki.org/wiki/API:Protect
+type ProtectOptions struct {
+	Reason string
+	// Cascade protects the pages transcluded in the page as well.
+	// Cascading protection requires edit protection at the sysop level.
+	Cascade   bool
+	Watchlist Watchlist
+	// Tags are the change tags applied to the log entry.
+	Tags []string
+}
+
+// ProtectResult contains the information returned by the API about
+// a successful change of protection.
+type ProtectResult struct {
+	Title       string
+	Reason      string
+	Cascade     bool
+	Protections []Protection
+}
+
+// Protect changes the protection of the page with the given title.
+// Protections for actions that are not in protections are left unchanged:
+// as the API removes the protection against any action that is not listed
+// in a request, Protect first reads the current protections of the page and
+// sends them along with the new ones. Protections that the page only has
+// because of cascading protection of other pages are not affected.
+// If the change fails, an APIError is returned (e.g. with the code
+// "protectedpage", "invalidexpiry" or "permissiondenied").
+func (w *Client) Protect(title string, protections []Protection, opts ProtectOptions) (*ProtectResult, error) {
+	return w.ProtectContext(context.Background(), title, protections, opts)
+}
+
+// ProtectContext is like Protect, but the requests are bound to ctx.
+func (w *Client) ProtectContext(ctx context.Context, title string, protections []Protection, opts ProtectOptions) (*ProtectResult, error) {
+	current, err := w.currentProtections(ctx, title)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read current protections: %v", err)
+	}
+	changed := make(map[string]bool, len(protections))
+	for _, pr := range protections {
+		changed[pr.Type] = true
+	}
+	protections = append([]Protection(nil), protections...)
+	for _, pr := range current {
+		if !changed[pr.Type] {
+			protections = append(protections, pr)
+		}
+	}
+
+	levels := make([]string, len(protections))
+	expiries := make([]string, len(protections))
+	for i, pr := range protections {
+		level := pr.Level
+		if level == "" {
+			level = "all"
+		}
+		levels[i] = pr.Type + "=" + level
+		expiries[i] = pr.Expiry
+		if expiries[i] == "" {
+			expiries[i] = "infinite"
+		}
+	}
+	p := params.Values{
+		"action":      "protect",
+		"title":       title,
+		"protections": strings.Join(levels, "|"),
+		"expiry":      strings.Join(expiries, "|"),
+	}
+	setReasonTags(p, opts.Reason, opts.Tags)
+	setFlag(p, "cascade", opts.Cascade)
+	setWatchlist(p, opts.Watchlist)
+
+	var resp struct {
+		Title       string              `json:"title"`
+		Reason      string              `json:"reason"`
+		Cascade     bool                `json:"cascade"`
+		Protections []map[string]string `json:"protections"`
+	}
+	if err := w.writeAction(ctx, CSRFToken, p, &resp); err != nil {
+		return nil, err
+	}
+
+	result := &ProtectResult{Title: resp.Title, Reason: resp.Reason, Cascade: resp.Cascade}
+	for _, m := range resp.Protections {
+		// Each protection is an object like {"edit":"sysop","expiry":"infinite"}.
+		pr := Protection{Expiry: m["expiry"]}
+		for k, v := range m {
+			if k != "expiry" {
+				pr.Type, pr.Level = k, v
+			}
+		}
+		result.Protections = append(result.Protections, pr)
+	}
+	return result, nil
+}
+
+// currentProtections returns the protections of the page with the given
+// title, except those inherited through cascading protection.
+func (w *Client) currentProtections(ctx context.Context, title string) ([]Protection, error) {
+	resp, err := w.GetContext(ctx, params.Values{
+		"action": "query",
+		"prop":   "info",
+		"inprop": "protection",
+		"titles": title,
+	})
+	if err != nil {
+		return nil, err
+	}
+	value, err := resp.GetValue("query", "pages")
+	if err != nil {
+		return nil, fmt.Errorf("invalid API response: %v", err)
+	}
+	valueBytes, err := value.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	var pages []struct {
+		Protection []struct {
+			Type   string `json:"type"`
+			Level  string `json:"level"`
+			Expiry string `json:"expiry"`
+			// Source is the page whose cascading protection the
+			// protection is inherited from.
+			Source string `json:"source"`
+		} `json:"protection"`
+	}
+	if err := json.Unmarshal(valueBytes, &pages); err != nil {
+		return nil, fmt.Errorf("error occured while decoding protections: %s", err)
+	}
+
+	var protections []Protection
+	for _, page := range pages {
+		for _, pr := range page.Protection {
+			if pr.Source == "" {
+				protections = append(protections, Protection{Type: pr.Type, Level: pr.Level, Expiry: pr.Expiry})
+			}
+		}
+	}
+	return protections, nil
+}
+
+// RollbackOptions contains options for Rollback.
+// See https://www.mediawiki.org/wiki/API:Rollback
+type RollbackOptions struct {
+	// Summary is the edit summary. If it is empty, the wiki's default
+	// rollback summary is used.
+	Summary string
+	// MarkBot marks the reverted edits and the rollback as bot edits.
+	MarkBot   bool
+	Watchlist Watchlist
+	// Tags are the change tags applied to the rollback.
+	Tags []string
+}
+
+// RollbackResult contains the information returned by the API about
+// a successful rollback.
+type RollbackResult struct {
+	Title   string `json:"title"`
+	PageID  int    `json:"pageid"`
+	Summary string `json:"summary"`
+	// RevID is the ID of the revision created by the rollback.
+	RevID int `json:"revid"`
+	// OldRevID is the ID of the last revision by the reverted user.
+	OldRevID int `json:"old_revid"`
+	// LastRevID is the ID of the revision that was restored.
+	LastRevID int `json:"last_revid"`
+}
+
+// Rollback reverts the last consecutive edits to the page with the given
+// title made by user.
+// If the rollback fails, an APIError is returned (e.g. with the code
+// "alreadyrolled" or "onlyauthor").
+func (w *Client) Rollback(title, user string, opts RollbackOptions) (*RollbackResult, error) {
+	return w.RollbackContext(context.Background(), title, user, opts)
+}
+
+// RollbackContext is like Rollback, but the requests are bound to ctx.
+func (w *Client) RollbackContext(ctx context.Context, title, user string, opts RollbackOptions) (*RollbackResult, error) {
+	p := params.Values{
+		"action": "rollback",
+		"title":  title,
+		"user":   user,
+	}
+	if opts.Summary != "" {
+		p["summary"] = opts.Summary
+	}
+	setReasonTags(p, "", opts.Tags)
+	setFlag(p, "markbot", opts.MarkBot)
+	setWatchlist(p, opts.Watchlist)
+
+	var result RollbackResult
+	if err := w.writeAction(ctx, RollbackToken, p, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// PatrolResult contains the information returned by the API about
+// a successful patrol.
+type PatrolResult struct {
+	// RCID is the ID of the patrolled recent change.
+	RCID      int    `json:"rcid"`
+	Namespace int    `json:"ns"`
+	Title     string `json:"title"`
+}
+
+// Patrol marks the recent change with the ID rcid as patrolled.
+// If patrolling fails, an APIError is returned (e.g. with the code
+// "nosuchrcid" or "permissiondenied").
+// See https://www.mediawiki.org/wiki/API:Patrol
+func (w *Client) Patrol(rcid int) (*PatrolResult, error) {
+	return w.PatrolContext(context.Background(), rcid)
+}
+
+// PatrolContext is like Patrol, but the requests are bound to ctx.
+func (w *Client) PatrolContext(ctx context.Context, rcid int) (*PatrolResult, error) {
+	return w.patrol(ctx, params.Values{"action": "patrol", "rcid": strconv.Itoa(rcid)})
+}
+
+// PatrolRevision is like Patrol, but marks the recent change of the
+// revision with the ID revid as patrolled.
+func (w *Client) PatrolRevision(revid int) (*PatrolResult, error) {
+	return w.PatrolRevisionContext(context.Background(), revid)
+}
+
+// PatrolRevisionContext is like PatrolRevision, but the requests are bound
+// to ctx.
+func (w *Client) PatrolRevisionContext(ctx context.Context, revid int) (*PatrolResult, error) {
+	return w.patrol(ctx, params.Values{"action": "patrol", "revid": strconv.Itoa(revid)})
+}
+
+func (w *Client) patrol(ctx context.Context, p params.Values) (*PatrolResult, error) {
+	var result PatrolResult
+	if err := w.writeAction(ctx, PatrolToken, p, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// writeAction posts p with the token named tokenName and decodes the value
+// named after the action in the response (usually an object) into result.
+func (w *Client) writeAction(ctx context.Context, tokenName string, p params.Values, result interface{}) error {
+	token, err := w.GetTokenContext(ctx, tokenName)
+	if err != nil {
+		return fmt.Errorf("unable to obtain %s token: %s", tokenName, err)
+	}
+	p["token"] = token
+
+	resp, err := w.PostContext(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	action := p.Get("action")
+	value, err := resp.GetValue(action)
+	if err != nil {
+		return fmt.Errorf("invalid API response: %v", err)
+	}
+	valueBytes, err := value.Marshal()
+	if err != nil {
+		return fmt.Errorf("error occured while decoding %s result: %s", action, err)
+	}
+	if err := json.Unmarshal(valueBytes, result); err != nil {
+		return fmt.Errorf("error occured while decoding %s result: %s", action, err)
+	}
+	return nil
+}
+
+// setFlag sets the boolean parameter key if value is true.
+func setFlag(p params.Values, key string, value bool) {
+	if value {
+		p[key] = "1"
+	}
+}
+
+func setReasonTags(p params.Values, reason string, tags []string) {
+	if reason != "" {
+		p["reason"] = reason
+	}
+	if len(tags) > 0 {
+		p.AddRange("tags", tags...)
+	}
+}
+
+func setWatchlist(p params.Values, watchlist Watchlist) {
+	if watchlist != "" {
+		p["watchlist"] = string(watchlist)
+	}
+}
@@ -0,0 +1,242 @@
+package mwclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// writeActionHandler returns a handler that checks that the request is
+// a POST request for action with the token VALIDTOKEN and the parameters in want,
+// and responds with resp.
+func writeActionHandler(t *testing.T, action string, want map[string]string, resp string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			panic("Bad HTTP form")
+		}
+		if r.Method != "POST" {
+			t.Fatalf("%s requests must be posted. Method: %v", action, r.Method)
+		}
+		if v := r.Form.Get("action"); v != action {
+			t.Fatalf("action != %s: action=%s", action, v)
+		}
+		if v := r.Form.Get("token"); v != "VALIDTOKEN" {
+			t.Fatalf("token != VALIDTOKEN: token=%s", v)
+		}
+		for k, v := range want {
+			if got := r.Form.Get(k); got != v {
+				t.Errorf("%s = %q, want %q", k, got, v)
+			}
+		}
+		fmt.Fprint(w, resp)
+	}
+}
+
+func TestMove(t *testing.T) {
+	want := map[string]string{
+		"from":         "Old",
+		"to":           "New",
+		"reason":       "rename",
+		"movetalk":     "1",
+		"movesubpages": "1",
+		"noredirect":   "",
+		"watchlist":    "nochange",
+		"tags":         "a|b",
+	}
+	resp := `{"move":{"from":"Old","to":"New","reason":"rename","redirectcreated":true,
+	"moveoverredirect":false,"talkfrom":"Talk:Old","talkto":"Talk:New",
+	"subpages":[{"from":"Old/1","to":"New/1"}]}}`
+
+	server, client := setup(writeActionHandler(t, "move", want, resp))
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	result, err := client.Move("Old", "New", MoveOptions{
+		Reason:       "rename",
+		MoveTalk:     true,
+		MoveSubpages: true,
+		Watchlist:    WatchlistNoChange,
+		Tags:         []string{"a", "b"},
+	})
+	if err != nil {
+		t.Fatalf("move returned error: %v", err)
+	}
+	wantResult := &MoveResult{
+		From:            "Old",
+		To:              "New",
+		Reason:          "rename",
+		RedirectCreated: true,
+		TalkFrom:        "Talk:Old",
+		TalkTo:          "Talk:New",
+		Subpages:        []MovedPage{{From: "Old/1", To: "New/1"}},
+	}
+	if !reflect.DeepEqual(result, wantResult) {
+		t.Errorf("Move = %+v, want %+v", result, wantResult)
+	}
+}
+
+func TestMoveError(t *testing.T) {
+	resp := `{"error":{"code":"cantmove","info":"You don't have permission to move this page."}}`
+	server, client := setup(writeActionHandler(t, "move", nil, resp))
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	_, err := client.Move("Old", "New", MoveOptions{})
+	var apiErr APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "cantmove" {
+		t.Fatalf("expected cantmove APIError, got %v", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	want := map[string]string{"title": "Spam", "reason": "spam", "deletetalk": "1"}
+	resp := `{"delete":{"title":"Spam","reason":"spam","logid":42}}`
+	server, client := setup(writeActionHandler(t, "delete", want, resp))
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	result, err := client.Delete("Spam", DeleteOptions{Reason: "spam", DeleteTalk: true})
+	if err != nil {
+		t.Fatalf("delete returned error: %v", err)
+	}
+	if want := (DeleteResult{Title: "Spam", Reason: "spam", LogID: 42}); *result != want {
+		t.Errorf("Delete = %+v, want %+v", *result, want)
+	}
+}
+
+func TestUndelete(t *testing.T) {
+	want := map[string]string{
+		"title":      "Page",
+		"timestamps": "2024-01-01T00:00:00Z|2024-01-02T00:00:00Z",
+	}
+	resp := `{"undelete":{"title":"Page","revisions":2,"fileversions":0,"reason":""}}`
+	server, client := setup(writeActionHandler(t, "undelete", want, resp))
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	result, err := client.Undelete("Page", UndeleteOptions{
+		Timestamps: []string{"2024-01-01T00:00:00Z", "2024-01-02T00:00:00Z"},
+	})
+	if err != nil {
+		t.Fatalf("undelete returned error: %v", err)
+	}
+	if result.Title != "Page" || result.Revisions != 2 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestProtect(t *testing.T) {
+	want := map[string]string{
+		"title":       "Main Page",
+		"protections": "edit=sysop|move=all|upload=autoconfirmed",
+		"expiry":      "1 week|infinite|infinity",
+		"cascade":     "1",
+	}
+	resp := `{"protect":{"title":"Main Page","reason":"vandalism","cascade":true,
+	"protections":[{"edit":"sysop","expiry":"2024-01-08T00:00:00Z"},{"move":"","expiry":"infinite"}]}}`
+	protect := writeActionHandler(t, "protect", want, resp)
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("action") != "query" {
+			protect(w, r)
+			return
+		}
+		if v := r.FormValue("inprop"); v != "protection" {
+			t.Errorf("inprop = %q, want protection", v)
+		}
+		// The upload protection is kept, the move protection is replaced
+		// and the protection inherited from Template:Cascade is ignored.
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"pageid":1,"ns":0,"title":"Main Page",
+		"protection":[{"type":"move","level":"sysop","expiry":"infinity"},
+		{"type":"upload","level":"autoconfirmed","expiry":"infinity"},
+		{"type":"create","level":"sysop","expiry":"infinity","source":"Template:Cascade"}]}]}}`)
+	})
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	result, err := client.Protect("Main Page", []Protection{
+		{Type: "edit", Level: "sysop", Expiry: "1 week"},
+		{Type: "move"},
+	}, ProtectOptions{Reason: "vandalism", Cascade: true})
+	if err != nil {
+		t.Fatalf("protect returned error: %v", err)
+	}
+	wantResult := &ProtectResult{
+		Title:   "Main Page",
+		Reason:  "vandalism",
+		Cascade: true,
+		Protections: []Protection{
+			{Type: "edit", Level: "sysop", Expiry: "2024-01-08T00:00:00Z"},
+			{Type: "move", Level: "", Expiry: "infinite"},
+		},
+	}
+	if !reflect.DeepEqual(result, wantResult) {
+		t.Errorf("Protect = %+v, want %+v", result, wantResult)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	want := map[string]string{"title": "Page", "user": "Vandal", "markbot": "1", "summary": ""}
+	resp := `{"rollback":{"title":"Page","pageid":7,"summary":"Reverted edits by Vandal",
+	"revid":12,"old_revid":11,"last_revid":10}}`
+	server, client := setup(writeActionHandler(t, "rollback", want, resp))
+	defer server.Close()
+
+	client.Tokens[RollbackToken] = "VALIDTOKEN"
+	result, err := client.Rollback("Page", "Vandal", RollbackOptions{MarkBot: true})
+	if err != nil {
+		t.Fatalf("rollback returned error: %v", err)
+	}
+	wantResult := RollbackResult{
+		Title:     "Page",
+		PageID:    7,
+		Summary:   "Reverted edits by Vandal",
+		RevID:     12,
+		OldRevID:  11,
+		LastRevID: 10,
+	}
+	if *result != wantResult {
+		t.Errorf("Rollback = %+v, want %+v", *result, wantResult)
+	}
+}
+
+func TestRollbackError(t *testing.T) {
+	resp := `{"error":{"code":"alreadyrolled","info":"The edit has already been rolled back."}}`
+	server, client := setup(writeActionHandler(t, "rollback", nil, resp))
+	defer server.Close()
+
+	client.Tokens[RollbackToken] = "VALIDTOKEN"
+	_, err := client.Rollback("Page", "Vandal", RollbackOptions{})
+	var apiErr APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "alreadyrolled" {
+		t.Fatalf("expected alreadyrolled APIError, got %v", err)
+	}
+}
+
+func TestPatrol(t *testing.T) {
+	resp := `{"patrol":{"rcid":123,"ns":0,"title":"Page"}}`
+	wantResult := PatrolResult{RCID: 123, Namespace: 0, Title: "Page"}
+
+	server, client := setup(writeActionHandler(t, "patrol", map[string]string{"rcid": "123", "revid": ""}, resp))
+	client.Tokens[PatrolToken] = "VALIDTOKEN"
+	result, err := client.Patrol(123)
+	server.Close()
+	if err != nil {
+		t.Fatalf("patrol returned error: %v", err)
+	}
+	if *result != wantResult {
+		t.Errorf("Patrol = %+v, want %+v", *result, wantResult)
+	}
+
+	server, client = setup(writeActionHandler(t, "patrol", map[string]string{"rcid": "", "revid": "456"}, resp))
+	defer server.Close()
+	client.Tokens[PatrolToken] = "VALIDTOKEN"
+	result, err = client.PatrolRevision(456)
+	if err != nil {
+		t.Fatalf("patrol returned error: %v", err)
+	}
+	if *result != wantResult {
+		t.Errorf("PatrolRevision = %+v, want %+v", *result, wantResult)
+	}
+}
@@ -0,0 +1,184 @@
+package mwclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// ClientLoginUI describes the additional information the API requires
+// to continue a ClientLogin, e.g. a two-factor authentication code.
+// See https://www.mediawiki.org/wiki/API:Login#Method_2._clientlogin
+type ClientLoginUI struct {
+	// Message is a human-readable message describing what is required
+	// (or what went wrong, e.g. if a two-factor code was wrong).
+	Message     string
+	MessageCode string
+	// Requests contains the authentication requests that need to be
+	// completed. Their fields are the values that must be supplied.
+	Requests []AuthRequest
+}
+
+// AuthRequest describes one authentication request within a ClientLoginUI.
+type AuthRequest struct {
+	ID       string `json:"id"`
+	Required string `json:"required"`
+	Provider string `json:"provider"`
+	Account  string `json:"account"`
+	// Fields maps the names of the fields (e.g. "OATHToken") to their
+	// descriptions.
+	Fields map[string]AuthField `json:"fields"`
+}
+
+// AuthField describes a field within an AuthRequest.
+type AuthField struct {
+	Type      string `json:"type"`
+	Label     string `json:"label"`
+	Help      string `json:"help"`
+	Optional  bool   `json:"optional"`
+	Sensitive bool   `json:"sensitive"`
+}
+
+// ClientLoginPrompter supplies the additional information requested by
+// the API during a ClientLogin.
+type ClientLoginPrompter interface {
+	// Prompt is called with the description of the information the API
+	// requires. It must return a map from field names (e.g. "OATHToken")
+	// to the values to send. If Prompt returns an error, ClientLogin is
+	// aborted and returns that error.
+	// Prompt may be called again if the API rejects the values, e.g.
+	// because a two-factor code was wrong.
+	Prompt(ui ClientLoginUI) (map[string]string, error)
+}
+
+// ClientLoginPromptFunc is an adapter to allow the use of ordinary functions
+// as ClientLoginPrompters.
+type ClientLoginPromptFunc func(ui ClientLoginUI) (map[string]string, error)
+
+// Prompt calls f(ui).
+func (f ClientLoginPromptFunc) Prompt(ui ClientLoginUI) (map[string]string, error) {
+	return f(ui)
+}
+
+// OATHPrompter returns a ClientLoginPrompter that supplies two-factor
+// authentication codes obtained by calling code.
+func OATHPrompter(code func() (string, error)) ClientLoginPrompter {
+	return ClientLoginPromptFunc(func(ui ClientLoginUI) (map[string]string, error) {
+		for _, req := range ui.Requests {
+			if _, ok := req.Fields["OATHToken"]; ok {
+				token, err := code()
+				if err != nil {
+					return nil, err
+				}
+				return map[string]string{"OATHToken": token}, nil
+			}
+		}
+		return nil, fmt.Errorf("unsupported login request: %s: %s", ui.MessageCode, ui.Message)
+	})
+}
+
+// ClientLogin attempts to login using the provided username and password
+// through action=clientlogin, which (unlike Login) supports multi-step
+// authentication such as two-factor authentication.
+//
+// If the API requires additional information, ClientLogin asks prompter for
+// it. prompter may be nil if no additional information is expected,
+// in which case a ClientLoginError with the status "UI" is returned if
+// the API asks for some anyway.
+//
+// If username is in the format of a bot password username ("User@BotName"),
+// ClientLogin uses Login instead, as bot passwords can not be used with
+// action=clientlogin.
+//
+// If the login fails, is redirected to a third party, or needs to be
+// restarted to link an account, a ClientLoginError is returned.
+// Do not use ClientLogin with OAuth.
+func (w *Client) ClientLogin(username, password string, prompter ClientLoginPrompter) error {
+	return w.ClientLoginContext(context.Background(), username, password, prompter)
+}
+
+// ClientLoginContext is like ClientLogin, but the requests are bound to ctx.
+func (w *Client) ClientLoginContext(ctx context.Context, username, password string, prompter ClientLoginPrompter) error {
+	if strings.Contains(username, "@") {
+		// '@' is not allowed in usernames, so this is a bot password.
+		return w.LoginContext(ctx, username, password)
+	}
+
+	token, err := w.GetTokenContext(ctx, LoginToken)
+	if err != nil {
+		return err
+	}
+	p := params.Values{
+		"action":         "clientlogin",
+		"username":       username,
+		"password":       password,
+		"loginreturnurl": w.apiURL.String(),
+		"logintoken":     token,
+	}
+
+	for {
+		resp, err := w.PostContext(ctx, p)
+		if err != nil {
+			return err
+		}
+		result, err := resp.GetObject("clientlogin")
+		if err != nil {
+			return fmt.Errorf("invalid API response: no clientlogin object")
+		}
+		raw, err := result.Marshal()
+		if err != nil {
+			return fmt.Errorf("error occured while decoding clientlogin response: %s", err)
+		}
+		var r clientLoginResponse
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return fmt.Errorf("error occured while decoding clientlogin response: %s", err)
+		}
+
+		switch r.Status {
+		case "PASS":
+			w.resetLimits()
+			return nil
+		case "UI":
+			ui := ClientLoginUI{
+				Message:     r.Message,
+				MessageCode: r.MessageCode,
+				Requests:    r.Requests,
+			}
+			if prompter == nil {
+				return ClientLoginError{Status: r.Status, Message: r.Message, MessageCode: r.MessageCode}
+			}
+			fields, err := prompter.Prompt(ui)
+			if err != nil {
+				return err
+			}
+			p = params.Values{
+				"action":        "clientlogin",
+				"logincontinue": "",
+				"logintoken":    token,
+			}
+			for k, v := range fields {
+				p[k] = v
+			}
+		case "FAIL", "REDIRECT", "RESTART":
+			return ClientLoginError{
+				Status:         r.Status,
+				Message:        r.Message,
+				MessageCode:    r.MessageCode,
+				RedirectTarget: r.RedirectTarget,
+			}
+		default:
+			return fmt.Errorf("invalid API response: unknown clientlogin status %q", r.Status)
+		}
+	}
+}
+
+type clientLoginResponse struct {
+	Status         string        `json:"status"`
+	Message        string        `json:"message"`
+	MessageCode    string        `json:"messagecode"`
+	RedirectTarget string        `json:"redirecttarget"`
+	Requests       []AuthRequest `json:"requests"`
+}
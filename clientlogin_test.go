@@ -0,0 +1,126 @@
+package mwclient
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestClientLoginTwoFactor(t *testing.T) {
+	step := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.Form.Get("meta") == "tokens" {
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"tokens":{"logintoken":"LOGINTOKEN+\\"}}}`)
+			return
+		}
+		if v := r.PostFormValue("action"); v != "clientlogin" {
+			t.Fatalf("action != clientlogin: action=%s", v)
+		}
+		if v := r.PostFormValue("logintoken"); v != `LOGINTOKEN+\` {
+			t.Errorf("unexpected logintoken: %s", v)
+		}
+
+		switch step {
+		case 0:
+			if r.PostFormValue("username") != "username" || r.PostFormValue("password") != "password" {
+				t.Errorf("unexpected credentials: %s", r.PostForm.Encode())
+			}
+			if r.PostFormValue("loginreturnurl") == "" {
+				t.Error("loginreturnurl not set")
+			}
+			fmt.Fprint(w, `{"clientlogin":{"status":"UI",
+			"message":"Enter a verification code from your authentication app.",
+			"messagecode":"oathauth-auth-ui",
+			"requests":[{"id":"TOTPAuthenticationRequest","metadata":{},"required":"required",
+			"provider":"","account":"",
+			"fields":{"OATHToken":{"type":"string","label":"Token","help":"Two-factor authentication token"}}}]}}`)
+		case 1:
+			if _, ok := r.PostForm["logincontinue"]; !ok {
+				t.Error("logincontinue not set")
+			}
+			if v := r.PostFormValue("OATHToken"); v != "123456" {
+				t.Errorf("OATHToken != 123456: OATHToken=%s", v)
+			}
+			fmt.Fprint(w, `{"clientlogin":{"status":"PASS","username":"Username"}}`)
+		default:
+			t.Fatalf("unexpected request #%d", step)
+		}
+		step++
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	prompts := 0
+	err := client.ClientLogin("username", "password", OATHPrompter(func() (string, error) {
+		prompts++
+		return "123456", nil
+	}))
+	if err != nil {
+		t.Fatalf("ClientLogin() returned err: %v", err)
+	}
+	if prompts != 1 {
+		t.Errorf("expected 1 prompt, got %d", prompts)
+	}
+}
+
+func TestClientLoginFail(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.Form.Get("meta") == "tokens" {
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"tokens":{"logintoken":"LOGINTOKEN"}}}`)
+			return
+		}
+		fmt.Fprint(w, `{"clientlogin":{"status":"FAIL",
+		"message":"Incorrect username or password entered.","messagecode":"wrongpassword"}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	err := client.ClientLogin("username", "wrong", nil)
+	e, ok := err.(ClientLoginError)
+	if !ok {
+		t.Fatalf("expected ClientLoginError, got %#v", err)
+	}
+	if e.Status != "FAIL" || e.MessageCode != "wrongpassword" {
+		t.Errorf("unexpected ClientLoginError: %#v", e)
+	}
+}
+
+func TestClientLoginBotPassword(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.Form.Get("meta") == "tokens" {
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"tokens":{"logintoken":"LOGINTOKEN"}}}`)
+			return
+		}
+		if v := r.PostFormValue("action"); v != "login" {
+			t.Fatalf("action != login for bot password: action=%s", v)
+		}
+		if v := r.PostFormValue("lgname"); v != "User@Bot" {
+			t.Errorf("lgname != User@Bot: lgname=%s", v)
+		}
+		fmt.Fprint(w, `{"login":{"result":"Success","lguserid":1,"lgusername":"User"}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	if err := client.ClientLogin("User@Bot", "botpassword", nil); err != nil {
+		t.Fatalf("ClientLogin() returned err: %v", err)
+	}
+}
@@ -1,15 +1,17 @@
 package mwclient
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log/slog"
 	"net/http"
 	"net/http/cookiejar"
-	"net/http/httputil"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"cgt.name/pkg/go-mwclient/params"
@@ -41,6 +43,10 @@ const maxSizeForQueryString = 8000
 
 type (
 	// Client represents the API client.
+	//
+	// A Client is safe for concurrent use by multiple goroutines, provided
+	// that its exported fields and settings (UserAgent, Maxlag, Assert,
+	// SetHTTPClient, etc.) are not modified while requests are in progress.
 	Client struct {
 		httpc  *http.Client
 		apiURL *url.URL
@@ -49,15 +55,53 @@ type (
 		// API token cache.
 		// Maps from name of token (e.g., "csrf") to token value.
 		// Use GetToken to obtain tokens.
+		// The map is guarded by an internal lock; it may only be accessed
+		// directly while the Client is not in concurrent use.
 		Tokens map[string]string
+		// tokensMu guards Tokens and tokenCalls.
+		tokensMu sync.Mutex
+		// tokenCalls holds the token requests currently in flight,
+		// keyed by token name.
+		tokenCalls map[string]*tokenCall
+		// MaxConcurrentBatches is the maximum number of requests the Get
+		// page methods will make concurrently when they have to split the
+		// requested pages into several batches. If it is less than 2
+		// (the default), the batches are requested one at a time.
+		MaxConcurrentBatches int
+		// limitsMu guards multiValueMax.
+		limitsMu sync.Mutex
+		// multiValueMax caches the result of multiValueLimit.
+		// Zero means unknown.
+		multiValueMax int
+		// readLimiter and writeLimiter enforce the rate limits configured
+		// with SetRateLimits. nil means no limit.
+		readLimiter, writeLimiter *rateLimiter
+		// RetryPolicy decides whether and when failed requests are retried.
+		// If RetryPolicy is nil (the default), requests are not retried,
+		// except for maxlag errors if Maxlag.On is true.
+		// Maxlag errors are retried according to Maxlag rather than
+		// RetryPolicy if Maxlag.On is true. See BackoffPolicy.
+		RetryPolicy RetryPolicy
+		// middlewares are added with Use.
+		middlewares []Middleware
+		// callMiddlewares are added with UseCall.
+		callMiddlewares []Middleware
+		// sleep is used for mocking time.Sleep in tests to avoid prolonging
+		// test execution needlessly by actually sleeping.
+		sleep sleeper
 		// Maxlag contains maxlag configuration for Client.
 		Maxlag Maxlag
+		// EditConflictRetries specifies how many times EditPage will retry
+		// an edit after an edit conflict before returning ErrEditConflict.
+		EditConflictRetries int
 		// If Assert is assigned the value of consts AssertUser or AssertBot,
 		// the 'assert' parameter will be added to API requests with
 		// the value 'user' or 'bot', respectively. To disable such assertions,
 		// set Assert to AssertNone (set by default by New()).
-		Assert assertType
-		debug  io.Writer
+		Assert  assertType
+		debug   io.Writer
+		logger  *slog.Logger
+		metrics Metrics
 	}
 
 	// Maxlag contains maxlag configuration for Client.
@@ -69,15 +113,14 @@ type (
 		Timeout string
 		// Specifies how many times to retry a request before returning with an error.
 		Retries int
-		// sleep is used for mocking time.Sleep in tests to avoid prolonging
-		// test execution needlessly by actually sleeping.
-		sleep sleeper
 	}
 )
 
 // SetDebug takes an io.Writer to which HTTP requests and responses
 // made by Client will be dumped with httputil to as they are sent and
-// received. To disable, set to nil (default).
+// received. Passwords, tokens, authorization headers and cookies are
+// redacted from the dumps. To disable, set to nil (default).
+// See also SetLogger.
 func (w *Client) SetDebug(wr io.Writer) { w.debug = wr }
 
 // SetHTTPTimeout overrides the default HTTP client timeout of 30 seconds.
@@ -92,8 +135,41 @@ func (w *Client) SetHTTPClient(httpc *http.Client) {
 	w.httpc = httpc
 }
 
-// sleeper is used for mocking time.Sleep.
-type sleeper func(d time.Duration)
+// WrapTransport replaces the transport of the Client's HTTP client with the
+// transport returned by wrap, which is passed the current transport (nil
+// means http.DefaultTransport). It can be used to authenticate requests in
+// ways go-mwclient does not support itself, e.g. with an oauth2.Transport
+// from golang.org/x/oauth2:
+//
+//	w.WrapTransport(func(base http.RoundTripper) http.RoundTripper {
+//		return &oauth2.Transport{Source: ts, Base: base}
+//	})
+//
+// WrapTransport keeps the Client's cookie jar, timeout and redirect policy.
+func (w *Client) WrapTransport(wrap func(base http.RoundTripper) http.RoundTripper) {
+	w.SetHTTPClient(&http.Client{
+		Transport:     wrap(w.httpc.Transport),
+		CheckRedirect: w.httpc.CheckRedirect,
+		Timeout:       w.httpc.Timeout,
+	})
+}
+
+// sleeper is used for mocking time.Sleep. It must return early with
+// ctx.Err() if ctx is done before d has elapsed.
+type sleeper func(ctx context.Context, d time.Duration) error
+
+// sleepContext pauses the current goroutine for at least the duration d,
+// or until ctx is done, whichever happens first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
 
 // New returns a pointer to an initialized Client object. If the provided API URL
 // is invalid (as defined by the net/url package), then it will return nil and
@@ -107,6 +183,8 @@ type sleeper func(d time.Duration)
 // New disables maxlag by default. To enable it, simply set
 // Client.Maxlag.On to true. The default timeout is 5 seconds and the default
 // amount of retries is 3.
+//
+// EditPage retries edits 3 times by default after edit conflicts.
 func New(inURL, userAgent string) (*Client, error) {
 	cookies, err := cookiejar.New(nil)
 	if err != nil {
@@ -139,144 +217,250 @@ func New(inURL, userAgent string) (*Client, error) {
 			On:      false,
 			Timeout: "5",
 			Retries: 3,
-			sleep:   time.Sleep,
 		},
-		Assert: AssertNone,
+		sleep:               sleepContext,
+		Assert:              AssertNone,
+		EditConflictRetries: 3,
 	}, nil
 }
 
 // call makes a GET or POST request to the Mediawiki API depending on whether
 // the post argument is true or false (if true, it will POST) and returns
-// the response body as an io.ReadCloser. Remember to close it when done with it.
+// the response.
 // call may not always respect the post argument being false in cases where
 // the request is very large; in such a case, the request will be POSTed anyway.
 // The MediaWiki API accepts POST on all endpoints.
+// The call passes through the Client's call middlewares (see UseCall),
+// and every attempt at the request passes through the Client's middlewares
+// (see Use), which set the format, maxlag and assert parameters.
 // call supports the maxlag parameter and will respect it if it is turned on
-// in the Client it operates on.
-func (w *Client) call(p params.Values, post bool) (io.ReadCloser, error) {
-	// The main functionality in this method is in a closure to simplify maxlag handling.
-	callf := func() (io.ReadCloser, error) {
-		p.Set("format", "json")
-		if version := p.Get("formatversion"); version == "1" {
-			p.Set("utf8", "")
-		} else if version == "" {
-			p.Set("formatversion", "2")
-			// utf8= is implicit in formatversion=2
-		}
-
-		if w.Maxlag.On && p.Get("maxlag") == "" {
-			// User has not set maxlag param manually. Use configured value.
-			p.Set("maxlag", w.Maxlag.Timeout)
-		}
-
-		switch w.Assert {
-		case AssertUser:
-			p.Set("assert", "user")
-		case AssertBot:
-			p.Set("assert", "bot")
-		}
+// in the Client it operates on. Every attempt at the request (including
+// maxlag retries) is subject to the Client's rate limits.
+// The request is bound to ctx; if ctx is canceled or its deadline expires,
+// the request and any pending maxlag wait are aborted.
+func (w *Client) call(ctx context.Context, p params.Values, post bool) (*Response, error) {
+	return w.callFiles(ctx, p, post, nil)
+}
 
-		// Check the length of text parameters; if any are big, we should
-		// use multipart/form-data per https://www.mediawiki.org/wiki/API:Edit#Large_edits
-		useMultipartEncoding := areParamsTooBig(p)
+// callFiles is like call, but it also sends files as file parts of
+// a multipart/form-data POST request. The content of the files is rewound
+// before every retry, so the request is only retried if the content of
+// every file implements io.Seeker.
+func (w *Client) callFiles(ctx context.Context, p params.Values, post bool, files []params.File) (*Response, error) {
+	return w.callRoundTripper()(&Request{Context: ctx, Params: p, Post: post, Files: files})
+}
 
-		var req *http.Request
-		var err error
-		var multipartContentType string
-		if useMultipartEncoding {
-			var body string
-			body, multipartContentType, err = p.EncodeMultipart()
+// attempts makes attempts at a request until it succeeds or may not be
+// retried. It is the RoundTripFunc at the end of the call middleware chain.
+func (w *Client) attempts(r *Request) (resp *Response, err error) {
+	ctx, p, post, files := r.Context, r.Params, r.Post, r.Files
+	var stats callStats
+	if w.logger != nil {
+		start := time.Now()
+		defer func() {
+			w.logCall(ctx, p, post, resp, err, stats, time.Since(start))
+		}()
+	}
 
-			if err != nil {
-				return nil, fmt.Errorf("unable to encode parameters as multipart (params: %v): %v", p, err)
+	rt := w.roundTripper()
+	write := isWriteRequest(p)
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			if err := rewindFiles(files); err != nil {
+				return nil, err
 			}
-			req, err = http.NewRequest("POST", w.apiURL.String(), strings.NewReader(body))
-		} else if post {
-			req, err = http.NewRequest("POST", w.apiURL.String(), strings.NewReader(p.Encode()))
-		} else {
-			req, err = http.NewRequest("GET", fmt.Sprintf("%s?%s", w.apiURL.String(), p.Encode()), nil)
 		}
-
-		if err != nil {
-			return nil, fmt.Errorf("unable to create HTTP request (params: %v): %v", p, err)
+		attemptStart := time.Now()
+		resp, err := rt(&Request{Context: ctx, Params: p, Post: post, Files: files, Attempt: attempt})
+		stats.attempts = attempt
+		stats.status = statusCode(resp, err)
+		if w.metrics != nil {
+			size := 0
+			if resp != nil {
+				size = len(resp.Body)
+			}
+			w.metrics.ObserveRequest(p.Get("action"), requestMethod(p, post), stats.status, time.Since(attemptStart), size)
 		}
 
-		// Set headers on request
-		req.Header.Set("User-Agent", w.UserAgent)
-		if useMultipartEncoding {
-			req.Header.Set("Content-Type", multipartContentType)
-		} else if post {
-			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if lagerr, ok := err.(maxLagError); ok && w.Maxlag.On {
+			// Maxlag retries are configured through Client.Maxlag
+			// rather than Client.RetryPolicy.
+			stats.lagWaits++
+			if stats.lagWaits >= w.Maxlag.Retries {
+				if w.metrics != nil {
+					w.metrics.ObserveAPIBusy(p.Get("action"))
+				}
+				return nil, ErrAPIBusy
+			}
+			if w.metrics != nil {
+				w.metrics.ObserveMaxlagRetry(p.Get("action"))
+			}
+			if err := w.sleep(ctx, time.Duration(lagerr.Wait)*time.Second); err != nil {
+				return nil, err
+			}
+			continue
 		}
 
-		if w.debug != nil {
-			reqdump, err := httputil.DumpRequestOut(req, true)
-			if err != nil {
-				fmt.Fprintf(w.debug, "Err dumping request: %v\n", err)
-			} else {
-				w.debug.Write(reqdump)
+		if w.RetryPolicy != nil {
+			a := Attempt{
+				Number: attempt,
+				Params: p,
+				Write:  write,
+				Err:    err,
+			}
+			switch e := err.(type) {
+			case nil:
+				a.Err = peekAPIError(resp.Body)
+				a.RetryAfter = parseRetryAfter(resp.Header)
+			case maxLagError:
+				a.Err = APIError{Code: "maxlag", Info: e.Message}
+				a.RetryAfter = time.Duration(e.Wait) * time.Second
+			case HTTPError:
+				a.RetryAfter = e.RetryAfter
+			}
+			if a.Err != nil && !isContextError(a.Err) {
+				if delay, retry := w.RetryPolicy.RetryDelay(a); retry {
+					if err := w.sleep(ctx, delay); err != nil {
+						return nil, err
+					}
+					continue
+				}
 			}
 		}
 
-		// Make the request
-		resp, err := w.httpc.Do(req)
 		if err != nil {
-			return nil, fmt.Errorf("error occured during HTTP request: %v", err)
+			return nil, err
 		}
+		return resp, nil
+	}
+}
 
-		if w.debug != nil {
-			respdump, err := httputil.DumpResponse(resp, true)
-			if err != nil {
-				fmt.Fprintf(w.debug, "Err dumping response: %v\n", err)
-			} else {
-				w.debug.Write(respdump)
-			}
+// transport is the RoundTripFunc at the end of the middleware chain.
+// It waits for the rate limit and sends the request over HTTP.
+func (w *Client) transport(r *Request) (*Response, error) {
+	ctx, p, post := r.Context, r.Params, r.Post
+	if err := w.waitRateLimit(ctx, p); err != nil {
+		return nil, err
+	}
+
+	// Check the length of text parameters; if any are big, we should
+	// use multipart/form-data per https://www.mediawiki.org/wiki/API:Edit#Large_edits
+	// Files can only be sent with multipart/form-data.
+	useMultipartEncoding := len(r.Files) > 0 || areParamsTooBig(p)
+
+	var req *http.Request
+	var err error
+	var multipartContentType string
+	if useMultipartEncoding {
+		// The body is encoded while it is being sent, so neither the
+		// parameters nor the files are copied into memory as a whole.
+		var body io.ReadCloser
+		body, multipartContentType = p.EncodeMultipartStream(r.Files...)
+		// Closing the body waits until the files are no longer being read,
+		// so that they can safely be rewound for a retry.
+		defer body.Close()
+		req, err = http.NewRequestWithContext(ctx, "POST", w.apiURL.String(), body)
+	} else if post {
+		req, err = http.NewRequestWithContext(ctx, "POST", w.apiURL.String(), strings.NewReader(p.Encode()))
+	} else {
+		req, err = http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s?%s", w.apiURL.String(), p.Encode()), nil)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to create HTTP request (params: %v): %v", p, err)
+	}
+
+	// Set headers on request
+	req.Header.Set("User-Agent", w.UserAgent)
+	if useMultipartEncoding {
+		req.Header.Set("Content-Type", multipartContentType)
+	} else if post {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	if w.debug != nil {
+		w.dumpRequest(req, p)
+	}
+
+	// Make the request
+	resp, err := w.httpc.Do(req)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
 		}
+		return nil, fmt.Errorf("error occured during HTTP request: %v", err)
+	}
+	defer resp.Body.Close()
 
-		// Handle maxlag
-		if resp.Header.Get("X-Database-Lag") != "" {
-			defer resp.Body.Close()
-			retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
-			if err != nil {
-				return nil, err
-			}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("error occured while reading HTTP response: %v", err)
+	}
 
-			body, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				return nil, err
-			}
+	if w.debug != nil {
+		w.dumpResponse(resp, body)
+	}
 
-			return nil, maxLagError{
-				string(body),
-				retryAfter,
-			}
+	// Handle maxlag
+	if resp.Header.Get("X-Database-Lag") != "" {
+		retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+		if err != nil {
+			return nil, err
 		}
 
-		return resp.Body, nil
+		return nil, maxLagError{
+			string(body),
+			retryAfter,
+		}
 	}
 
-	if w.Maxlag.On {
-		for tries := 0; tries < w.Maxlag.Retries; tries++ {
-			resp, err := callf()
+	if resp.StatusCode >= 400 {
+		return nil, HTTPError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			RetryAfter: parseRetryAfter(resp.Header),
+		}
+	}
 
-			// Logic for handling maxlag errors. If err is nil or a different error,
-			// they are passed through in the else.
-			if lagerr, ok := err.(maxLagError); ok {
-				// If there are no tries left, don't wait needlessly.
-				if tries < w.Maxlag.Retries-1 {
-					w.Maxlag.sleep(time.Duration(lagerr.Wait) * time.Second)
-				}
-				continue
-			} else {
-				return resp, err
-			}
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, nil
+}
+
+// rewindFiles rewinds the content of files to the start so that they can
+// be sent again.
+func rewindFiles(files []params.File) error {
+	for _, f := range files {
+		seeker, ok := f.Content.(io.Seeker)
+		if !ok {
+			return fmt.Errorf("unable to retry request: content of file %q cannot be rewound", f.Name)
 		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("unable to retry request: %v", err)
+		}
+	}
+	return nil
+}
 
-		return nil, ErrAPIBusy
+// requestMethod returns the HTTP method call uses for a request.
+func requestMethod(p params.Values, post bool) string {
+	if post || areParamsTooBig(p) {
+		return "POST"
 	}
+	return "GET"
+}
 
-	// If maxlag is not enabled, just do the request regularly.
-	return callf()
+// statusCode returns the HTTP status code of an attempt at a request,
+// or zero if it is unknown.
+func statusCode(resp *Response, err error) int {
+	if resp != nil {
+		return resp.StatusCode
+	}
+	if httpErr, ok := err.(HTTPError); ok {
+		return httpErr.StatusCode
+	}
+	return 0
 }
 
 // callJSON wraps the call method and encodes the JSON response
@@ -284,39 +468,99 @@ func (w *Client) call(p params.Values, post bool) (io.ReadCloser, error) {
 // extracted and returned as the error return value (unless an error occurs
 // during the API call or the parsing of the JSON response, in which case that
 // error will be returned and the *jason.Object return value will be nil).
-func (w *Client) callJSON(p params.Values, post bool) (*jason.Object, error) {
-	body, err := w.call(p, post)
-	if err != nil {
+//
+// If a POST request carrying a token from the token cache is rejected by
+// the API because the token is invalid, callJSON discards the cached token,
+// obtains a fresh one and replays the request once.
+func (w *Client) callJSON(ctx context.Context, p params.Values, post bool) (*jason.Object, error) {
+	return w.callJSONFiles(ctx, p, post, nil)
+}
+
+// callJSONFiles is like callJSON, but it also sends files (see callFiles).
+func (w *Client) callJSONFiles(ctx context.Context, p params.Values, post bool, files []params.File) (*jason.Object, error) {
+	js, err := w.callJSONOnce(ctx, p, post, files)
+	if !post {
+		return js, err
+	}
+	renewed, renewErr := w.renewStaleToken(ctx, p, err)
+	if renewErr != nil {
+		return nil, renewErr
+	}
+	if !renewed {
+		return js, err
+	}
+	if err := rewindFiles(files); err != nil {
 		return nil, err
 	}
-	if body != nil {
-		defer body.Close()
+
+	return w.callJSONOnce(ctx, p, post, files)
+}
+
+// renewStaleToken checks whether err is the API's rejection of a token from
+// the token cache sent as the token parameter in p. If it is, the cached
+// token is discarded, a fresh one is obtained and set in p, and
+// renewStaleToken returns true so that the request can be replayed.
+func (w *Client) renewStaleToken(ctx context.Context, p params.Values, err error) (bool, error) {
+	if !isBadTokenError(err) {
+		return false, nil
+	}
+	staleToken := p.Get("token")
+	tokenName, ok := w.cachedTokenName(staleToken)
+	if !ok {
+		return false, nil
+	}
+	w.invalidateToken(tokenName, staleToken)
+	token, tokenErr := w.GetTokenContext(ctx, tokenName)
+	if tokenErr != nil {
+		return false, fmt.Errorf("unable to renew %s token after %v: %v", tokenName, err, tokenErr)
+	}
+	p.Set("token", token)
+	return true, nil
+}
+
+// callJSONOnce implements callJSONFiles without the token renewal.
+func (w *Client) callJSONOnce(ctx context.Context, p params.Values, post bool, files []params.File) (*jason.Object, error) {
+	resp, err := w.callFiles(ctx, p, post, files)
+	if err != nil {
+		return nil, err
 	}
 
-	js, err := jason.NewObjectFromReader(body)
+	js, err := resp.JSON()
 	if err != nil {
 		return nil, err
 	}
 
-	return js, extractAPIErrors(js)
+	err = extractAPIErrors(js)
+	if apierr, ok := err.(APIError); ok && w.metrics != nil {
+		w.metrics.ObserveAPIError(p.Get("action"), apierr.Code)
+	}
+	return js, err
 }
 
-// callRaw wraps the call method and reads the response body into a []byte.
-func (w *Client) callRaw(p params.Values, post bool) ([]byte, error) {
-	body, err := w.call(p, post)
+// callRaw wraps the call method and returns the response body as a []byte.
+// Like callJSON, it replays a POST request once with a fresh token if the
+// API rejects a cached token.
+func (w *Client) callRaw(ctx context.Context, p params.Values, post bool) ([]byte, error) {
+	resp, err := w.call(ctx, p, post)
 	if err != nil {
 		return nil, err
 	}
-	if body != nil {
-		defer body.Close()
+	if !post {
+		return resp.Body, nil
 	}
 
-	buf, err := ioutil.ReadAll(body)
+	renewed, err := w.renewStaleToken(ctx, p, peekAPIError(resp.Body))
 	if err != nil {
 		return nil, err
 	}
-
-	return buf, nil
+	if !renewed {
+		return resp.Body, nil
+	}
+	resp, err = w.call(ctx, p, post)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
 }
 
 // Get performs a GET request with the specified parameters and returns the
@@ -327,7 +571,12 @@ func (w *Client) callRaw(p params.Values, post bool) ([]byte, error) {
 // Get will return any API errors and/or warnings (if no other errors occur)
 // as the error return value.
 func (w *Client) Get(p params.Values) (*jason.Object, error) {
-	return w.callJSON(p, false)
+	return w.GetContext(context.Background(), p)
+}
+
+// GetContext is like Get, but the request is bound to ctx.
+func (w *Client) GetContext(ctx context.Context, p params.Values) (*jason.Object, error) {
+	return w.callJSON(ctx, p, false)
 }
 
 // GetRaw performs a GET request with the specified parameters
@@ -339,30 +588,57 @@ func (w *Client) Get(p params.Values) (*jason.Object, error) {
 // GetRaw is useful when you want to decode the JSON into a struct for easier
 // and safer use.
 func (w *Client) GetRaw(p params.Values) ([]byte, error) {
-	return w.callRaw(p, false)
+	return w.GetRawContext(context.Background(), p)
+}
+
+// GetRawContext is like GetRaw, but the request is bound to ctx.
+func (w *Client) GetRawContext(ctx context.Context, p params.Values) ([]byte, error) {
+	return w.callRaw(ctx, p, false)
 }
 
 // Post performs a POST request with the specified parameters and returns the
 // response as a *jason.Object.
 // Post will return any API errors and/or warnings (if no other errors occur)
 // as the error return value.
+// If the request carries a token obtained through GetToken and the API
+// rejects it as invalid (badtoken), Post renews the token and retries
+// the request once.
 func (w *Client) Post(p params.Values) (*jason.Object, error) {
-	return w.callJSON(p, true)
+	return w.PostContext(context.Background(), p)
+}
+
+// PostContext is like Post, but the request is bound to ctx.
+func (w *Client) PostContext(ctx context.Context, p params.Values) (*jason.Object, error) {
+	return w.callJSON(ctx, p, true)
 }
 
 // PostRaw performs a POST request with the specified parameters
 // and returns the raw JSON response as a []byte.
-// Unlike Post, PostRaw does not check for API errors/warnings.
+// Unlike Post, PostRaw does not check for API errors/warnings, except that
+// like Post, it renews a stale cached token and replays the request once if
+// the API rejects the token.
 // PostRaw is useful when you want to decode the JSON into a struct for easier
 // and safer use.
 func (w *Client) PostRaw(p params.Values) ([]byte, error) {
-	return w.callRaw(p, true)
+	return w.PostRawContext(context.Background(), p)
+}
+
+// PostRawContext is like PostRaw, but the request is bound to ctx.
+func (w *Client) PostRawContext(ctx context.Context, p params.Values) ([]byte, error) {
+	return w.callRaw(ctx, p, true)
 }
 
 // Login attempts to login using the provided username and password.
+// Login uses action=login, which MediaWiki only supports for bot passwords.
+// To log in with the password of a main account, use ClientLogin.
 // Do not use Login with OAuth.
 func (w *Client) Login(username, password string) error {
-	token, err := w.GetToken(LoginToken)
+	return w.LoginContext(context.Background(), username, password)
+}
+
+// LoginContext is like Login, but the requests are bound to ctx.
+func (w *Client) LoginContext(ctx context.Context, username, password string) error {
+	token, err := w.GetTokenContext(ctx, LoginToken)
 	if err != nil {
 		return err
 	}
@@ -372,7 +648,7 @@ func (w *Client) Login(username, password string) error {
 		"lgpassword": password,
 		"lgtoken":    token,
 	}
-	resp, err := w.Post(v)
+	resp, err := w.PostContext(ctx, v)
 	if err != nil {
 		return err
 	}
@@ -387,6 +663,7 @@ func (w *Client) Login(username, password string) error {
 		}
 		return apierr
 	}
+	w.resetLimits()
 	return nil
 }
 
@@ -394,7 +671,13 @@ func (w *Client) Login(username, password string) error {
 // Logout does not take into account whether or not a user is actually logged in.
 // Do not use Logout with OAuth.
 func (w *Client) Logout() error {
-	_, err := w.GetRaw(params.Values{"action": "logout"})
+	return w.LogoutContext(context.Background())
+}
+
+// LogoutContext is like Logout, but the request is bound to ctx.
+func (w *Client) LogoutContext(ctx context.Context) error {
+	_, err := w.GetRawContext(ctx, params.Values{"action": "logout"})
+	w.resetLimits()
 	return err
 }
 
@@ -402,6 +685,7 @@ func (w *Client) Logout() error {
 // will be authenticated. OAuth does not make any API calls, so authentication
 // failures will appear in response to the first API call after OAuth has
 // been configured. Do not mix use of OAuth with Login/Logout.
+// To obtain an access token through the OAuth handshake, see NewOAuthFlow.
 func (w *Client) OAuth(consumerToken, consumerSecret, accessToken, accessSecret string) error {
 	consumer := oauth.NewConsumer(consumerToken, consumerSecret, oauth.ServiceProvider{})
 	access := oauth.AccessToken{
@@ -411,6 +695,7 @@ func (w *Client) OAuth(consumerToken, consumerSecret, accessToken, accessSecret
 	httpc, err := consumer.MakeHttpClient(&access)
 	if err == nil {
 		w.SetHTTPClient(httpc)
+		w.resetLimits()
 	}
 	return err
 }
@@ -1,18 +1,21 @@
 package mwclient
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"cgt.name/pkg/go-mwclient/params"
 )
 
-func noSleep(d time.Duration) {
-	return // the test monster under my bed is keeping me awake
+func noSleep(ctx context.Context, d time.Duration) error {
+	return nil // the test monster under my bed is keeping me awake
 }
 
 func setup(handler func(w http.ResponseWriter, r *http.Request)) (*httptest.Server, *Client) {
@@ -21,7 +24,7 @@ func setup(handler func(w http.ResponseWriter, r *http.Request)) (*httptest.Serv
 	if err != nil {
 		panic(err)
 	}
-	client.Maxlag.sleep = noSleep
+	client.sleep = noSleep
 
 	return server, client
 }
@@ -132,7 +135,7 @@ func TestMaxlagOn(t *testing.T) {
 
 	p := params.Values{}
 	client.Maxlag.On = true
-	client.call(p, false)
+	client.call(context.Background(), p, false)
 }
 
 func TestMaxlagOff(t *testing.T) {
@@ -152,7 +155,7 @@ func TestMaxlagOff(t *testing.T) {
 
 	p := params.Values{}
 	// Maxlag is off by default
-	client.call(p, false)
+	client.call(context.Background(), p, false)
 }
 
 func TestMaxlagRetryFail(t *testing.T) {
@@ -175,7 +178,7 @@ func TestMaxlagRetryFail(t *testing.T) {
 
 	p := params.Values{}
 	client.Maxlag.On = true
-	_, err := client.call(p, false)
+	_, err := client.call(context.Background(), p, false)
 	if err != ErrAPIBusy {
 		t.Fatalf("Expected ErrAPIBusy error from call(), got: %v", err)
 	}
@@ -202,7 +205,7 @@ func TestMultipartOffForSmallParameters(t *testing.T) {
 	p := params.Values{
 		"test": smallPayload,
 	}
-	client.call(p, false)
+	client.call(context.Background(), p, false)
 }
 
 func TestMultipartOnForLargeParameters(t *testing.T) {
@@ -226,7 +229,7 @@ func TestMultipartOnForLargeParameters(t *testing.T) {
 	p := params.Values{
 		"test": bigPayload,
 	}
-	client.call(p, false)
+	client.call(context.Background(), p, false)
 }
 
 func TestAssertOff(t *testing.T) {
@@ -294,3 +297,148 @@ func TestAssertBot(t *testing.T) {
 	client.Assert = AssertBot
 	client.Get(p)
 }
+
+func TestGetContextCanceled(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request should not have been sent: %s", r.URL)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := client.GetContext(ctx, params.Values{})
+	if err != context.Canceled {
+		t.Fatalf("Expected context.Canceled from GetContext(), got: %v", err)
+	}
+}
+
+func TestMaxlagSleepCanceled(t *testing.T) {
+	reqCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		reqCount++
+		header := w.Header()
+		header.Set("X-Database-Lag", "10")
+		header.Set("Retry-After", "60")
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	client.Maxlag.On = true
+	client.sleep = sleepContext
+	start := time.Now()
+	_, err := client.call(ctx, params.Values{}, false)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded from call(), got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("maxlag sleep was not interrupted: call() took %v", elapsed)
+	}
+	if reqCount != 1 {
+		t.Fatalf("Expected 1 request, got %d", reqCount)
+	}
+}
+
+func TestConcurrentGet(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+		fmt.Fprintf(w, `{"batchcomplete":true,"n":%q}`, r.Form.Get("n"))
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+	client.Maxlag.On = true
+	client.Assert = AssertUser
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			n := strconv.Itoa(i)
+			resp, err := client.Get(params.Values{"n": n})
+			if err != nil {
+				t.Errorf("Get() returned err: %v", err)
+				return
+			}
+			if got, _ := resp.GetString("n"); got != n {
+				t.Errorf("response mismatch: expected n=%s, got n=%s", n, got)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestPostRawRenewsBadToken(t *testing.T) {
+	var tokenRequests, postRequests int
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		switch {
+		case r.Form.Get("meta") == "tokens":
+			tokenRequests++
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"tokens":{"csrftoken":"FRESHTOKEN"}}}`)
+		case r.Form.Get("action") == "purge":
+			postRequests++
+			if r.Form.Get("token") != "FRESHTOKEN" {
+				fmt.Fprint(w, `{"error":{"code":"badtoken","info":"Invalid CSRF token."}}`)
+				return
+			}
+			fmt.Fprint(w, `{"batchcomplete":true,"purge":[{"ns":0,"title":"PAGE","purged":true}]}`)
+		default:
+			t.Fatalf("Unexpected request: %s", r.Form.Encode())
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "STALETOKEN"
+	body, err := client.PostRaw(params.Values{"action": "purge", "titles": "PAGE", "token": "STALETOKEN"})
+	if err != nil {
+		t.Fatalf("PostRaw returned error: %v", err)
+	}
+	if !strings.Contains(string(body), `"purged":true`) {
+		t.Errorf("unexpected response: %s", body)
+	}
+	if tokenRequests != 1 {
+		t.Errorf("expected 1 token request, got %d", tokenRequests)
+	}
+	if postRequests != 2 {
+		t.Errorf("expected 2 POST requests, got %d", postRequests)
+	}
+}
+
+func TestPostRawUncachedBadToken(t *testing.T) {
+	var postRequests int
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		postRequests++
+		fmt.Fprint(w, `{"error":{"code":"badtoken","info":"Invalid CSRF token."}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	// A token that is not in the cache is not renewed; the raw error
+	// response is returned to the caller.
+	body, err := client.PostRaw(params.Values{"action": "purge", "token": "FOREIGNTOKEN"})
+	if err != nil {
+		t.Fatalf("PostRaw returned error: %v", err)
+	}
+	if !strings.Contains(string(body), "badtoken") {
+		t.Errorf("unexpected response: %s", body)
+	}
+	if postRequests != 1 {
+		t.Errorf("expected 1 POST request, got %d", postRequests)
+	}
+}
@@ -1,10 +1,12 @@
 package mwclient
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
+	"sync"
 
 	"github.com/antonholmquist/jason"
 
@@ -15,6 +17,12 @@ import (
 // a page but was otherwise successful.
 var ErrEditNoChange = errors.New("edit successful, but did not change page")
 
+// ErrEditConflict is returned by Client.EditPage() when the page could not be
+// edited because of edit conflicts, even after retrying.
+// APIErrors with the code "editconflict" also match ErrEditConflict
+// when compared with errors.Is.
+var ErrEditConflict = errors.New("edit conflict")
+
 // ErrPageNotFound is returned when a page is not found.
 // See GetPage[s]ByName().
 var ErrPageNotFound = errors.New("wiki page not found")
@@ -40,50 +48,254 @@ var ErrPageNotFound = errors.New("wiki page not found")
 //		"notminor": "",
 //	}
 func (w *Client) Edit(p params.Values) error {
+	return w.EditContext(context.Background(), p)
+}
+
+// EditContext is like Edit, but the requests are bound to ctx.
+func (w *Client) EditContext(ctx context.Context, p params.Values) error {
+	result, err := w.EditWithResultContext(ctx, p)
+	if err != nil {
+		return err
+	}
+	if result.NoChange {
+		return ErrEditNoChange
+	}
+	return nil
+}
+
+// EditResult contains the information returned by the API about
+// a successful edit.
+// See https://www.mediawiki.org/wiki/API:Edit#Response
+type EditResult struct {
+	PageID       int    `json:"pageid"`
+	Title        string `json:"title"`
+	ContentModel string `json:"contentmodel"`
+	// OldRevID is the ID of the revision that was current before the edit.
+	// It is zero if the page was created.
+	OldRevID int `json:"oldrevid"`
+	// NewRevID is the ID of the revision created by the edit.
+	// It is zero if NoChange is true.
+	NewRevID     int    `json:"newrevid"`
+	NewTimestamp string `json:"newtimestamp"`
+	// New is true if the edit created the page.
+	New bool `json:"new"`
+	// NoChange is true if the edit did not change the page because the new
+	// text was identical to the current text. No revision is created in
+	// that case.
+	NoChange bool `json:"nochange"`
+	Watched  bool `json:"watched"`
+}
+
+// EditWithResult is like Edit, but on success it returns the information
+// the API returns about the edit as an EditResult.
+// Unlike Edit, EditWithResult does not return ErrEditNoChange if the edit
+// did not change the page; instead, EditResult.NoChange is set.
+func (w *Client) EditWithResult(p params.Values) (*EditResult, error) {
+	return w.EditWithResultContext(context.Background(), p)
+}
+
+// EditWithResultContext is like EditWithResult, but the requests are
+// bound to ctx.
+func (w *Client) EditWithResultContext(ctx context.Context, p params.Values) (*EditResult, error) {
 	// If edit token not set, obtain one from API or cache
 	if p["token"] == "" {
-		csrfToken, err := w.GetToken(CSRFToken)
+		csrfToken, err := w.GetTokenContext(ctx, CSRFToken)
 		if err != nil {
-			return fmt.Errorf("unable to obtain csrf token: %s", err)
+			return nil, fmt.Errorf("unable to obtain csrf token: %s", err)
 		}
 		p["token"] = csrfToken
 	}
 
 	p["action"] = "edit"
 
-	resp, err := w.Post(p)
+	resp, err := w.PostContext(ctx, p)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	editResult, err := resp.GetString("edit", "result")
 	if err != nil {
-		return fmt.Errorf("unable to assert 'result' field to type string")
+		return nil, fmt.Errorf("unable to assert 'result' field to type string")
 	}
 
 	if editResult != "Success" {
 		if captcha, err := resp.GetObject("edit", "captcha"); err == nil {
 			captchaBytes, err := captcha.Marshal()
 			if err != nil {
-				return fmt.Errorf("error occured while creating error message: %s", err)
+				return nil, fmt.Errorf("error occured while creating error message: %s", err)
 			}
 			var captchaerr CaptchaError
 			err = json.Unmarshal(captchaBytes, &captchaerr)
 			if err != nil {
-				return fmt.Errorf("error occured while creating error message: %s", err)
+				return nil, fmt.Errorf("error occured while creating error message: %s", err)
 			}
-			return captchaerr
+			return nil, captchaerr
 		}
 
 		edit, _ := resp.GetValue("edit")
-		return fmt.Errorf("unrecognized response: %v", edit)
+		return nil, fmt.Errorf("unrecognized response: %v", edit)
 	}
 
-	if nochange, err := resp.GetBoolean("edit", "nochange"); err == nil && nochange {
-		return ErrEditNoChange
+	edit, err := resp.GetObject("edit")
+	if err != nil {
+		return nil, fmt.Errorf("invalid API response: %v", err)
+	}
+	editBytes, err := edit.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("error occured while decoding edit result: %s", err)
+	}
+	var result EditResult
+	err = json.Unmarshal(editBytes, &result)
+	if err != nil {
+		return nil, fmt.Errorf("error occured while decoding edit result: %s", err)
 	}
 
-	return nil
+	return &result, nil
+}
+
+// Undo undoes the revision with the ID revid of the page with the given
+// title, and returns the result of the edit. If undoafter is not zero, all
+// revisions from revid back to, but not including, undoafter are undone.
+// If summary is empty, the wiki's default undo summary is used.
+// If the revisions cannot be undone because of conflicting later edits,
+// an APIError with the code "undofailure" is returned.
+// See https://www.mediawiki.org/wiki/API:Edit
+func (w *Client) Undo(title string, revid, undoafter int, summary string) (*EditResult, error) {
+	return w.UndoContext(context.Background(), title, revid, undoafter, summary)
+}
+
+// UndoContext is like Undo, but the requests are bound to ctx.
+func (w *Client) UndoContext(ctx context.Context, title string, revid, undoafter int, summary string) (*EditResult, error) {
+	p := params.Values{
+		"title": title,
+		"undo":  strconv.Itoa(revid),
+	}
+	if undoafter != 0 {
+		p["undoafter"] = strconv.Itoa(undoafter)
+	}
+	if summary != "" {
+		p["summary"] = summary
+	}
+	return w.EditWithResultContext(ctx, p)
+}
+
+// EditFunc is the type of the function called by EditPage to compute
+// the new content of a page from its current content.
+// If the page does not exist, old is the empty string.
+// If EditFunc returns an error, EditPage aborts and returns that error.
+type EditFunc func(old string) (new string, summary string, err error)
+
+// EditPage edits the page with the given title by applying the function fn
+// to the current content of the page, protecting against edit conflicts.
+//
+// EditPage retrieves the current content of the page, calls fn and submits
+// the edit with the basetimestamp, starttimestamp and baserevid parameters
+// set, so that the API rejects the edit if someone else edited (or deleted
+// or created) the page in the meantime. In that case, EditPage retrieves
+// the page again and reapplies fn, up to Client.EditConflictRetries times,
+// after which it returns ErrEditConflict.
+// fn may therefore be called more than once.
+//
+// If fn does not change the content of the page, no edit is made and
+// ErrEditNoChange is returned.
+func (w *Client) EditPage(title string, fn EditFunc) error {
+	return w.EditPageContext(context.Background(), title, fn)
+}
+
+// EditPageContext is like EditPage, but the requests are bound to ctx.
+func (w *Client) EditPageContext(ctx context.Context, title string, fn EditFunc) error {
+	for tries := 0; tries <= w.EditConflictRetries; tries++ {
+		page, starttimestamp, err := w.getPageForEdit(ctx, title)
+		if err != nil {
+			return err
+		}
+
+		var old string
+		exists := page.Error == nil
+		if exists {
+			old = page.Content()
+		} else if page.Error != ErrPageNotFound {
+			return page.Error
+		}
+
+		text, summary, err := fn(old)
+		if err != nil {
+			return err
+		}
+		if exists && text == old {
+			return ErrEditNoChange
+		}
+
+		p := params.Values{
+			"title":          title,
+			"text":           text,
+			"summary":        summary,
+			"starttimestamp": starttimestamp,
+		}
+		if exists {
+			p["basetimestamp"] = page.Timestamp
+			p["baserevid"] = strconv.Itoa(page.RevID)
+			p["nocreate"] = "1"
+		} else {
+			p["createonly"] = "1"
+		}
+
+		err = w.EditContext(ctx, p)
+		if !isEditConflict(err) {
+			return err
+		}
+	}
+	return ErrEditConflict
+}
+
+// isEditConflict reports whether err means that an edit made by EditPage
+// conflicted with another change to the page.
+func isEditConflict(err error) bool {
+	apierr, ok := err.(APIError)
+	if !ok {
+		return false
+	}
+	switch apierr.Code {
+	case "editconflict", "articleexists", "pagedeleted", "missingtitle":
+		return true
+	}
+	return false
+}
+
+// getPageForEdit retrieves the current revision of a page along with
+// the current server time, to be used as starttimestamp when editing it.
+func (w *Client) getPageForEdit(ctx context.Context, title string) (page Page, starttimestamp string, err error) {
+	p := params.Values{
+		"action":       "query",
+		"prop":         "revisions",
+		"rvprop":       "ids|timestamp|content",
+		"rvslots":      "main",
+		"titles":       title,
+		"curtimestamp": "",
+	}
+
+	r, err := w.call(ctx, p, false)
+	if err != nil {
+		return Page{}, "", err
+	}
+
+	var resp getPagesResponse
+	err = json.Unmarshal(r.Body, &resp)
+	if err != nil {
+		return Page{}, "", err
+	}
+	if resp.CurTimestamp == "" {
+		return Page{}, "", fmt.Errorf("invalid API response: no curtimestamp")
+	}
+	pages, err := handleGetPages([]string{title}, resp)
+	if err != nil {
+		return Page{}, "", err
+	}
+	page, ok := pages[title]
+	if !ok {
+		return Page{}, "", fmt.Errorf("invalid API response: page %q not returned", title)
+	}
+	return page, resp.CurTimestamp, nil
 }
 
 // BriefRevision contains basic information on a single revision of a page.
@@ -98,8 +310,8 @@ type BriefRevision struct {
 // The page is specified either by its name or by its ID.
 // If the isName parameter is true, then the pageIDorName parameter will be
 // assumed to be a page name and vice versa.
-func (w *Client) getPage(pageIDorName string, isName bool) (content string, timestamp string, err error) {
-	pages, err := w.getPages(isName, pageIDorName)
+func (w *Client) getPage(ctx context.Context, pageIDorName string, isName bool) (content string, timestamp string, err error) {
+	pages, err := w.getPages(ctx, isName, pageIDorName)
 	if pages == nil && err != nil {
 		return "", "", err
 	}
@@ -113,38 +325,227 @@ func (w *Client) getPage(pageIDorName string, isName bool) (content string, time
 // getPages is just like getPage, but performs a multi-query so that
 // only one API request will be used to get the contents of many pages.
 // Maps the input name onto a BriefRevision result.
-func (w *Client) getPages(areNames bool, pageIDsOrNames ...string) (pages map[string]BriefRevision, err error) {
+func (w *Client) getPages(ctx context.Context, areNames bool, pageIDsOrNames ...string) (pages map[string]BriefRevision, err error) {
+	fullPages, err := w.getFullPages(ctx, briefRevisionProps, areNames, pageIDsOrNames...)
+	if fullPages == nil {
+		return nil, err
+	}
+
+	pages = make(map[string]BriefRevision, len(fullPages))
+	for name, page := range fullPages {
+		brief := BriefRevision{Error: page.Error}
+		if page.Error == nil {
+			brief.PageID = strconv.Itoa(page.PageID)
+			brief.Content = page.Content()
+			brief.Timestamp = page.Timestamp
+		}
+		pages[name] = brief
+	}
+	return pages, err
+}
+
+// revisionProps contains the values of the rvprop and rvslots parameters
+// used when retrieving pages.
+type revisionProps struct {
+	rvprop, rvslots string
+}
+
+var (
+	// briefRevisionProps are used to fill out BriefRevisions.
+	briefRevisionProps = revisionProps{
+		rvprop:  "content|timestamp",
+		rvslots: "main",
+	}
+	// fullRevisionProps are used to fill out Pages.
+	fullRevisionProps = revisionProps{
+		rvprop:  "ids|flags|timestamp|user|userid|size|slotsize|sha1|slotsha1|contentmodel|comment|content",
+		rvslots: "*",
+	}
+)
+
+// getFullPages retrieves the pages specified by pageIDsOrNames along with the
+// revision properties specified by props.
+// Maps the input name onto a Page result.
+//
+// If there are more pages than the API allows in a single request, the pages
+// are split into batches which are requested separately (concurrently,
+// if Client.MaxConcurrentBatches allows it) and the results are merged.
+func (w *Client) getFullPages(ctx context.Context, props revisionProps, areNames bool, pageIDsOrNames ...string) (pages map[string]Page, err error) {
 	if len(pageIDsOrNames) == 0 {
 		return nil, ErrNoArgs
 	}
+	if len(pageIDsOrNames) <= lowMultiValueLimit {
+		return w.getFullPagesBatch(ctx, props, areNames, pageIDsOrNames)
+	}
+
+	limit, err := w.multiValueLimit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine API limits: %v", err)
+	}
+	var batches [][]string
+	for len(pageIDsOrNames) > 0 {
+		n := min(limit, len(pageIDsOrNames))
+		batches = append(batches, pageIDsOrNames[:n])
+		pageIDsOrNames = pageIDsOrNames[n:]
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]map[string]Page, len(batches))
+	errs := make([]error, len(batches))
+	sem := make(chan struct{}, max(1, w.MaxConcurrentBatches))
+	var wg sync.WaitGroup
+	for i, batch := range batches {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int, batch []string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i], errs[i] = w.getFullPagesBatch(ctx, props, areNames, batch)
+			if results[i] == nil {
+				// Don't bother with the remaining batches.
+				cancel()
+			}
+		}(i, batch)
+	}
+	wg.Wait()
+
+	pages = make(map[string]Page)
+	var warnings APIWarnings
+	var failed error
+	incomplete := false
+	for i, result := range results {
+		if result == nil {
+			incomplete = true
+			// Prefer the error that caused the other batches to be canceled.
+			if errs[i] != nil && (failed == nil || isContextError(failed)) {
+				failed = errs[i]
+			}
+			continue
+		}
+		for name, page := range result {
+			pages[name] = page
+		}
+		if batchWarnings, ok := errs[i].(APIWarnings); ok {
+			warnings = append(warnings, batchWarnings...)
+		}
+	}
+	if incomplete {
+		if failed == nil {
+			failed = ctx.Err()
+		}
+		return nil, failed
+	}
+	if warnings != nil {
+		return pages, warnings
+	}
+	return pages, nil
+}
+
+// These consts are the limits on the number of values the API accepts for
+// multi-value parameters such as titles and pageids.
+const (
+	lowMultiValueLimit  = 50
+	highMultiValueLimit = 500
+)
+
+// multiValueLimit returns the maximum number of values the API accepts for
+// multi-value parameters: highMultiValueLimit if the user has the
+// apihighlimits right and lowMultiValueLimit otherwise.
+// The result is cached until the user logs in or out.
+func (w *Client) multiValueLimit(ctx context.Context) (int, error) {
+	w.limitsMu.Lock()
+	limit := w.multiValueMax
+	w.limitsMu.Unlock()
+	if limit != 0 {
+		return limit, nil
+	}
+
+	resp, err := w.GetContext(ctx, params.Values{
+		"action": "query",
+		"meta":   "userinfo",
+		"uiprop": "rights",
+	})
+	if err != nil {
+		return 0, err
+	}
+	rights, err := resp.GetStringArray("query", "userinfo", "rights")
+	if err != nil {
+		return 0, fmt.Errorf("invalid API response: unable to get user rights: %v", err)
+	}
+
+	limit = lowMultiValueLimit
+	for _, right := range rights {
+		if right == "apihighlimits" {
+			limit = highMultiValueLimit
+			break
+		}
+	}
+
+	w.limitsMu.Lock()
+	w.multiValueMax = limit
+	w.limitsMu.Unlock()
+	return limit, nil
+}
 
+// resetLimits discards the cached API limits. It must be called whenever
+// the user the Client is authenticated as may have changed.
+func (w *Client) resetLimits() {
+	w.limitsMu.Lock()
+	w.multiValueMax = 0
+	w.limitsMu.Unlock()
+}
+
+// getFullPagesBatch implements getFullPages for a single batch of pages.
+func (w *Client) getFullPagesBatch(ctx context.Context, props revisionProps, areNames bool, pageIDsOrNames []string) (pages map[string]Page, err error) {
 	p := params.Values{
 		"action":  "query",
 		"prop":    "revisions",
-		"rvprop":  "content|timestamp",
-		"rvslots": "main",
+		"rvprop":  props.rvprop,
+		"rvslots": props.rvslots,
 	}
 	if areNames {
 		p.AddRange("titles", pageIDsOrNames...)
 	} else {
 		p.AddRange("pageids", pageIDsOrNames...)
 	}
+	p.Set("continue", "")
 
-	r, err := w.call(p, false)
-	if err != nil {
-		return nil, err
-	}
-	defer r.Close()
-
+	// When the content of the pages exceeds the maximum result size,
+	// the API leaves the revisions of the remaining pages out and returns
+	// a continuation, so keep requesting until the batch is complete.
 	var resp getPagesResponse
-	err = json.NewDecoder(r).Decode(&resp)
-	if err != nil {
-		return nil, err
+	for {
+		r, err := w.call(ctx, p, false)
+		if err != nil {
+			return nil, err
+		}
+
+		var part getPagesResponse
+		err = json.Unmarshal(r.Body, &part)
+		if err != nil {
+			return nil, err
+		}
+		resp.merge(part)
+
+		if len(part.Continue) == 0 {
+			break
+		}
+		for k, v := range part.Continue {
+			p.Set(k, v)
+		}
 	}
 	return handleGetPages(pageIDsOrNames, resp)
 }
 
-func handleGetPages(pageNames []string, resp getPagesResponse) (pages map[string]BriefRevision, err error) {
+func handleGetPages(pageNames []string, resp getPagesResponse) (pages map[string]Page, err error) {
 	// Return warnings as errors along with any data.
 	// If a warning is returned, it is possible that the data is wrong.
 	// For example, the query could have asked for more than 50 pages,
@@ -173,9 +574,12 @@ func handleGetPages(pageNames []string, resp getPagesResponse) (pages map[string
 		}
 	}
 
-	pages = make(map[string]BriefRevision, len(pageNames))
+	pages = make(map[string]Page, len(pageNames))
 	for _, entry := range resp.Query.Pages {
-		var page BriefRevision
+		page := Page{
+			Namespace: entry.Namespace,
+			Title:     entry.Title,
+		}
 
 		// Missing and Special errors are not mutually exclusive,
 		// but treat them as if they were because it's easier.
@@ -183,14 +587,27 @@ func handleGetPages(pageNames []string, resp getPagesResponse) (pages map[string
 			page.Error = ErrPageNotFound
 		} else if entry.Special {
 			page.Error = errors.New("special pages not supported for this query")
+		} else if len(entry.Revisions) == 0 {
+			page.Error = errors.New("no revisions returned for page")
 		}
 
 		if page.Error == nil {
-			page.PageID = strconv.Itoa(entry.PageID)
+			page.PageID = entry.PageID
 
 			rev := entry.Revisions[0]
-			page.Content = rev.Slots.Main.Content
+			page.RevID = rev.RevID
+			page.ParentID = rev.ParentID
 			page.Timestamp = rev.Timestamp
+			page.User = rev.User
+			page.UserID = rev.UserID
+			page.Comment = rev.Comment
+			page.Minor = rev.Minor
+			page.Size = rev.Size
+			page.SHA1 = rev.SHA1
+			page.Slots = make(map[string]Slot, len(rev.Slots))
+			for role, slot := range rev.Slots {
+				page.Slots[role] = Slot(slot)
+			}
 		}
 
 		var title string
@@ -206,53 +623,184 @@ func handleGetPages(pageNames []string, resp getPagesResponse) (pages map[string
 }
 
 type getPagesResponse struct {
-	Warnings json.RawMessage `json:"warnings"`
-	Query    struct {
+	Warnings     json.RawMessage   `json:"warnings"`
+	CurTimestamp string            `json:"curtimestamp"`
+	Continue     map[string]string `json:"continue"`
+	Query        struct {
 		Normalized []struct {
 			From string `json:"from"`
 			To   string `json:"to"`
 		} `json:"normalized"`
-		Pages []struct {
-			Missing   bool   `json:"missing"`
-			Special   bool   `json:"special"`
-			PageID    int    `json:"pageid"`
-			Title     string `json:"title"`
-			Revisions []struct {
-				Timestamp string `json:"timestamp"`
-				Slots     struct {
-					Main struct {
-						ContentModel  string `json:"contentmodel"`
-						ContentFormat string `json:"contentformat"`
-						Content       string `json:"content"`
-					}
-				}
-			} `json:"revisions"`
-		} `json:"pages"`
+		Pages []getPagesEntry `json:"pages"`
 	} `json:"query"`
 }
 
+type getPagesEntry struct {
+	Missing   bool   `json:"missing"`
+	Special   bool   `json:"special"`
+	PageID    int    `json:"pageid"`
+	Namespace int    `json:"ns"`
+	Title     string `json:"title"`
+	Revisions []struct {
+		RevID     int    `json:"revid"`
+		ParentID  int    `json:"parentid"`
+		Minor     bool   `json:"minor"`
+		User      string `json:"user"`
+		UserID    int    `json:"userid"`
+		Timestamp string `json:"timestamp"`
+		Size      int    `json:"size"`
+		SHA1      string `json:"sha1"`
+		Comment   string `json:"comment"`
+		Slots     map[string]struct {
+			Size          int    `json:"size"`
+			SHA1          string `json:"sha1"`
+			ContentModel  string `json:"contentmodel"`
+			ContentFormat string `json:"contentformat"`
+			Content       string `json:"content"`
+		} `json:"slots"`
+	} `json:"revisions"`
+}
+
+// key identifies the page in a response. Nonexistent page IDs have no
+// title, so they are identified by ID.
+func (e getPagesEntry) key() string {
+	if e.Title == "" {
+		return "#" + strconv.Itoa(e.PageID)
+	}
+	return e.Title
+}
+
+// merge merges part, a continuation of the response r, into r.
+// Every continuation lists all pages again, but only the pages whose
+// revisions did not fit into the previous responses have revisions.
+func (r *getPagesResponse) merge(part getPagesResponse) {
+	if r.Warnings == nil {
+		r.Warnings = part.Warnings
+	}
+	if r.CurTimestamp == "" {
+		r.CurTimestamp = part.CurTimestamp
+	}
+	if r.Query.Normalized == nil {
+		r.Query.Normalized = part.Query.Normalized
+	}
+
+	index := make(map[string]int, len(r.Query.Pages))
+	for i, page := range r.Query.Pages {
+		index[page.key()] = i
+	}
+	for _, page := range part.Query.Pages {
+		i, ok := index[page.key()]
+		if !ok {
+			index[page.key()] = len(r.Query.Pages)
+			r.Query.Pages = append(r.Query.Pages, page)
+			continue
+		}
+		if len(r.Query.Pages[i].Revisions) == 0 {
+			r.Query.Pages[i].Revisions = page.Revisions
+		}
+	}
+}
+
+// Page contains information on a page and its most recent revision.
+// See GetPages.
+type Page struct {
+	PageID    int
+	Namespace int
+	Title     string
+
+	// Information on the most recent revision of the page.
+	RevID     int
+	ParentID  int
+	Timestamp string
+	User      string
+	UserID    int
+	Comment   string
+	Minor     bool
+	// Size is the size of the revision in bytes.
+	Size int
+	SHA1 string
+	// Slots maps slot role names (e.g., "main") to the contents of
+	// the slots of the revision.
+	// See https://www.mediawiki.org/wiki/Multi-Content_Revisions
+	Slots map[string]Slot
+
+	// Error is set if the page could not be retrieved,
+	// e.g. ErrPageNotFound if the page does not exist.
+	Error error
+}
+
+// Content returns the content of the main slot of the revision.
+func (p Page) Content() string {
+	return p.Slots["main"].Content
+}
+
+// Slot contains the content of a single slot of a revision.
+type Slot struct {
+	Size          int
+	SHA1          string
+	ContentModel  string
+	ContentFormat string
+	Content       string
+}
+
+// GetPages gets multiple pages (specified by their names) along with
+// the content of every slot and the metadata of their most recent revisions.
+// Returns a map of input page names to Pages.
+func (w *Client) GetPages(pageNames ...string) (pages map[string]Page, err error) {
+	return w.getFullPages(context.Background(), fullRevisionProps, true, pageNames...)
+}
+
+// GetPagesContext is like GetPages, but the request is bound to ctx.
+func (w *Client) GetPagesContext(ctx context.Context, pageNames ...string) (pages map[string]Page, err error) {
+	return w.getFullPages(ctx, fullRevisionProps, true, pageNames...)
+}
+
 // GetPageByName gets the content of a page (specified by its name) and
 // the timestamp of its most recent revision.
 func (w *Client) GetPageByName(pageName string) (content string, timestamp string, err error) {
-	return w.getPage(pageName, true)
+	return w.getPage(context.Background(), pageName, true)
+}
+
+// GetPageByNameContext is like GetPageByName, but the request is bound to ctx.
+func (w *Client) GetPageByNameContext(ctx context.Context, pageName string) (content string, timestamp string, err error) {
+	return w.getPage(ctx, pageName, true)
 }
 
 // GetPagesByName gets the contents of multiple pages (specified by their names).
 // Returns a map of input page names to BriefRevisions.
+// If more pages are requested than the API allows in a single request
+// (50, or 500 for users with the apihighlimits right), they are retrieved
+// in several requests. See Client.MaxConcurrentBatches.
 func (w *Client) GetPagesByName(pageNames ...string) (pages map[string]BriefRevision, err error) {
-	return w.getPages(true, pageNames...)
+	return w.getPages(context.Background(), true, pageNames...)
+}
+
+// GetPagesByNameContext is like GetPagesByName, but the request is bound to ctx.
+func (w *Client) GetPagesByNameContext(ctx context.Context, pageNames ...string) (pages map[string]BriefRevision, err error) {
+	return w.getPages(ctx, true, pageNames...)
 }
 
 // GetPageByID gets the content of a page (specified by its id) and
 // the timestamp of its most recent revision.
 func (w *Client) GetPageByID(pageID string) (content string, timestamp string, err error) {
-	return w.getPage(pageID, false)
+	return w.getPage(context.Background(), pageID, false)
+}
+
+// GetPageByIDContext is like GetPageByID, but the request is bound to ctx.
+func (w *Client) GetPageByIDContext(ctx context.Context, pageID string) (content string, timestamp string, err error) {
+	return w.getPage(ctx, pageID, false)
 }
 
 // GetPagesByID gets the content of pages (specified by id).
 // Returns a map of input page names to BriefRevisions.
+// Like GetPagesByName, GetPagesByID splits large requests into batches.
 func (w *Client) GetPagesByID(pageIDs ...string) (pages map[string]BriefRevision, err error) {
-	return w.getPages(false, pageIDs...)
+	return w.getPages(context.Background(), false, pageIDs...)
+}
+
+// GetPagesByIDContext is like GetPagesByID, but the request is bound to ctx.
+func (w *Client) GetPagesByIDContext(ctx context.Context, pageIDs ...string) (pages map[string]BriefRevision, err error) {
+	return w.getPages(ctx, false, pageIDs...)
 }
 
 // These consts represents MW API token names.
@@ -276,21 +824,112 @@ const (
 // tokenName should be "edit" (or whatever), not "edittoken".
 // The token consts (e.g., mwclient.CSRFToken) should be used
 // as the tokenName argument.
+//
+// GetToken is safe for concurrent use. If several goroutines request the same
+// uncached token at the same time, only one API request is made and its
+// result is shared between them.
 func (w *Client) GetToken(tokenName string) (string, error) {
+	return w.GetTokenContext(context.Background(), tokenName)
+}
+
+// GetTokenContext is like GetToken, but the request (if any) is bound to ctx.
+func (w *Client) GetTokenContext(ctx context.Context, tokenName string) (string, error) {
 	// Always obtain a fresh login token
-	if tokenName != LoginToken {
+	if tokenName == LoginToken {
+		return w.fetchToken(ctx, tokenName)
+	}
+
+	for {
+		w.tokensMu.Lock()
 		if tok, ok := w.Tokens[tokenName]; ok {
+			w.tokensMu.Unlock()
 			return tok, nil
 		}
+		if c, ok := w.tokenCalls[tokenName]; ok {
+			// Another goroutine is already fetching this token; wait for it.
+			w.tokensMu.Unlock()
+			select {
+			case <-c.done:
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+			if isContextError(c.err) && ctx.Err() == nil {
+				// The other goroutine gave up, but we haven't. Try again.
+				continue
+			}
+			return c.token, c.err
+		}
+
+		c := &tokenCall{done: make(chan struct{})}
+		if w.tokenCalls == nil {
+			w.tokenCalls = make(map[string]*tokenCall)
+		}
+		w.tokenCalls[tokenName] = c
+		w.tokensMu.Unlock()
+
+		c.token, c.err = w.fetchToken(ctx, tokenName)
+
+		w.tokensMu.Lock()
+		if c.err == nil {
+			if w.Tokens == nil {
+				w.Tokens = make(map[string]string)
+			}
+			w.Tokens[tokenName] = c.token
+		}
+		delete(w.tokenCalls, tokenName)
+		w.tokensMu.Unlock()
+		close(c.done)
+
+		return c.token, c.err
+	}
+}
+
+// cachedTokenName returns the name of the cached token whose value is
+// token, if any.
+func (w *Client) cachedTokenName(token string) (string, bool) {
+	if token == "" {
+		return "", false
 	}
 
+	w.tokensMu.Lock()
+	defer w.tokensMu.Unlock()
+	for name, value := range w.Tokens {
+		if value == token {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// invalidateToken removes the token tokenName from the token cache,
+// but only if its cached value is still stale. This prevents concurrent
+// requests that failed with the same stale token from discarding a fresh
+// token that has already been obtained by one of them.
+func (w *Client) invalidateToken(tokenName, stale string) {
+	w.tokensMu.Lock()
+	defer w.tokensMu.Unlock()
+	if w.Tokens[tokenName] == stale {
+		delete(w.Tokens, tokenName)
+	}
+}
+
+// tokenCall represents a token request in flight.
+// done is closed once token and err have been set.
+type tokenCall struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// fetchToken retrieves a token from the API, bypassing the token cache.
+func (w *Client) fetchToken(ctx context.Context, tokenName string) (string, error) {
 	p := params.Values{
 		"action": "query",
 		"meta":   "tokens",
 		"type":   tokenName,
 	}
 
-	resp, err := w.Get(p)
+	resp, err := w.GetContext(ctx, p)
 	if err != nil {
 		return "", err
 	}
@@ -300,8 +939,11 @@ func (w *Client) GetToken(tokenName string) (string, error) {
 		// This really shouldn't happen.
 		return "", fmt.Errorf("error occured while converting token to string: %s", err)
 	}
-	if tokenName != LoginToken {
-		w.Tokens[tokenName] = token
-	}
 	return token, nil
 }
+
+// isContextError reports whether err is a context cancellation or
+// deadline error.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -2,9 +2,15 @@ package mwclient
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"cgt.name/pkg/go-mwclient/params"
 )
@@ -282,3 +288,671 @@ func TestHandleGetPagesReturnsBothWarningsAndPageErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestConcurrentEditFetchesTokenOnce(t *testing.T) {
+	var tokenRequests, editRequests int32
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		switch {
+		case r.Form.Get("meta") == "tokens":
+			atomic.AddInt32(&tokenRequests, 1)
+			// Give the other goroutines a chance to pile up.
+			time.Sleep(10 * time.Millisecond)
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"tokens":{"csrftoken":"VALIDTOKEN"}}}`)
+		case r.Form.Get("action") == "edit":
+			atomic.AddInt32(&editRequests, 1)
+			if v := r.Form.Get("token"); v != "VALIDTOKEN" {
+				t.Errorf("token != VALIDTOKEN: token=%s", v)
+			}
+			fmt.Fprint(w, `{"edit":{"result":"Success","pageid":42,"title":"PAGE"}}`)
+		default:
+			t.Errorf("Unexpected request: %s", r.Form.Encode())
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := client.Edit(params.Values{
+				"title": fmt.Sprintf("Page %d", i),
+				"text":  "text",
+			})
+			if err != nil {
+				t.Errorf("edit request returned error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if tokenRequests != 1 {
+		t.Errorf("expected 1 token request, got %d", tokenRequests)
+	}
+	if editRequests != n {
+		t.Errorf("expected %d edit requests, got %d", n, editRequests)
+	}
+}
+
+func TestConcurrentGetTokenSharesError(t *testing.T) {
+	var tokenRequests int32
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&tokenRequests, 1)
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprint(w, `{"error":{"code":"internal_api_error","info":"broken"}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	const n = 20
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if _, err := client.GetToken(CSRFToken); err == nil {
+				t.Error("expected error from GetToken, got nil")
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if tokenRequests < 1 || tokenRequests > n {
+		t.Errorf("unexpected number of token requests: %d", tokenRequests)
+	}
+	if _, ok := client.Tokens[CSRFToken]; ok {
+		t.Error("failed token request was cached")
+	}
+}
+
+func TestEditRenewsBadToken(t *testing.T) {
+	var tokenRequests, editRequests int
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		switch {
+		case r.Form.Get("meta") == "tokens":
+			tokenRequests++
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"tokens":{"csrftoken":"FRESHTOKEN"}}}`)
+		case r.Form.Get("action") == "edit":
+			editRequests++
+			if r.Form.Get("token") != "FRESHTOKEN" {
+				fmt.Fprint(w, `{"error":{"code":"badtoken","info":"Invalid CSRF token."}}`)
+				return
+			}
+			fmt.Fprint(w, `{"edit":{"result":"Success","pageid":42,"title":"PAGE"}}`)
+		default:
+			t.Fatalf("Unexpected request: %s", r.Form.Encode())
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "STALETOKEN"
+	err := client.Edit(params.Values{})
+	if err != nil {
+		t.Fatalf("edit request returned error: %v", err)
+	}
+	if tokenRequests != 1 {
+		t.Errorf("expected 1 token request, got %d", tokenRequests)
+	}
+	if editRequests != 2 {
+		t.Errorf("expected 2 edit requests, got %d", editRequests)
+	}
+	if tok := client.Tokens[CSRFToken]; tok != "FRESHTOKEN" {
+		t.Errorf("expected cached token FRESHTOKEN, got %s", tok)
+	}
+}
+
+func TestEditRenewsBadTokenOnlyOnce(t *testing.T) {
+	var tokenRequests, editRequests int
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.Form.Get("meta") == "tokens" {
+			tokenRequests++
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"tokens":{"csrftoken":"ALSOBAD"}}}`)
+			return
+		}
+		editRequests++
+		fmt.Fprint(w, `{"error":{"code":"badtoken","info":"Invalid CSRF token."}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "STALETOKEN"
+	err := client.Edit(params.Values{})
+	if e, ok := err.(APIError); !ok || e.Code != "badtoken" {
+		t.Fatalf("expected badtoken APIError, got %#v", err)
+	}
+	if tokenRequests != 1 {
+		t.Errorf("expected 1 token request, got %d", tokenRequests)
+	}
+	if editRequests != 2 {
+		t.Errorf("expected 2 edit requests, got %d", editRequests)
+	}
+}
+
+func TestPostBadUncachedTokenNotRenewed(t *testing.T) {
+	requests := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"error":{"code":"badtoken","info":"Invalid CSRF token."}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "CACHEDTOKEN"
+	_, err := client.Post(params.Values{"action": "purge", "token": "OTHERTOKEN"})
+	if e, ok := err.(APIError); !ok || e.Code != "badtoken" {
+		t.Fatalf("expected badtoken APIError, got %#v", err)
+	}
+	if requests != 1 {
+		t.Errorf("expected 1 request, got %d", requests)
+	}
+	if tok := client.Tokens[CSRFToken]; tok != "CACHEDTOKEN" {
+		t.Errorf("cached token was modified: %s", tok)
+	}
+}
+
+func TestGetPages(t *testing.T) {
+	resp := `{
+  "batchcomplete": true,
+  "query": {
+    "normalized": [{"fromencoded": false, "from": "File:example.jpg", "to": "File:Example.jpg"}],
+    "pages": [
+      {
+        "pageid": 42,
+        "ns": 6,
+        "title": "File:Example.jpg",
+        "revisions": [
+          {
+            "revid": 1001,
+            "parentid": 1000,
+            "minor": true,
+            "user": "Example",
+            "userid": 7,
+            "timestamp": "2024-01-02T03:04:05Z",
+            "size": 150,
+            "sha1": "b1946ac92492d2347c6235b4d2611184",
+            "comment": "add caption",
+            "slots": {
+              "main": {
+                "size": 100,
+                "sha1": "aaaa",
+                "contentmodel": "wikitext",
+                "contentformat": "text/x-wiki",
+                "content": "== Summary =="
+              },
+              "mediainfo": {
+                "size": 50,
+                "sha1": "bbbb",
+                "contentmodel": "wikibase-mediainfo",
+                "contentformat": "application/json",
+                "content": "{}"
+              }
+            }
+          }
+        ]
+      },
+      {"ns": 0, "title": "Missing", "missing": true}
+    ]
+  }
+}`
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+		if v := r.Form.Get("rvslots"); v != "*" {
+			t.Errorf("rvslots != *: rvslots=%s", v)
+		}
+		if v := r.Form.Get("titles"); v != "File:example.jpg|Missing" {
+			t.Errorf("unexpected titles: titles=%s", v)
+		}
+		fmt.Fprint(w, resp)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	pages, err := client.GetPages("File:example.jpg", "Missing")
+	if err != nil {
+		t.Fatalf("GetPages returned error: %v", err)
+	}
+
+	page, ok := pages["File:example.jpg"]
+	if !ok {
+		t.Fatalf("page not found in result: %v", pages)
+	}
+	if page.Error != nil {
+		t.Fatalf("unexpected page error: %v", page.Error)
+	}
+	if page.PageID != 42 || page.Namespace != 6 || page.Title != "File:Example.jpg" {
+		t.Errorf("unexpected page info: %+v", page)
+	}
+	if page.RevID != 1001 || page.ParentID != 1000 || !page.Minor ||
+		page.User != "Example" || page.UserID != 7 || page.Comment != "add caption" ||
+		page.Size != 150 || page.SHA1 != "b1946ac92492d2347c6235b4d2611184" ||
+		page.Timestamp != "2024-01-02T03:04:05Z" {
+		t.Errorf("unexpected revision info: %+v", page)
+	}
+	if page.Content() != "== Summary ==" {
+		t.Errorf("unexpected main slot content: %s", page.Content())
+	}
+	mi, ok := page.Slots["mediainfo"]
+	if !ok {
+		t.Fatalf("mediainfo slot missing: %+v", page.Slots)
+	}
+	if mi.ContentModel != "wikibase-mediainfo" || mi.ContentFormat != "application/json" ||
+		mi.Content != "{}" || mi.Size != 50 || mi.SHA1 != "bbbb" {
+		t.Errorf("unexpected mediainfo slot: %+v", mi)
+	}
+
+	if missing := pages["Missing"]; missing.Error != ErrPageNotFound {
+		t.Errorf("expected ErrPageNotFound for missing page, got %v", missing.Error)
+	}
+}
+
+func TestGetPagesContinuation(t *testing.T) {
+	requests := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+		requests++
+		if r.Form.Get("rvcontinue") == "" {
+			fmt.Fprint(w, `{"continue":{"rvcontinue":"2|20","continue":"||"},"query":{"pages":[
+			{"pageid":1,"ns":0,"title":"A","revisions":[{"revid":10,"timestamp":"2024-01-01T00:00:00Z","slots":{"main":{"content":"a"}}}]},
+			{"pageid":2,"ns":0,"title":"B"}]}}`)
+			return
+		}
+		if v := r.Form.Get("rvcontinue"); v != "2|20" {
+			t.Errorf("rvcontinue = %q", v)
+		}
+		if v := r.Form.Get("titles"); v != "A|B" {
+			t.Errorf("unexpected titles on continuation: titles=%s", v)
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[
+		{"pageid":1,"ns":0,"title":"A"},
+		{"pageid":2,"ns":0,"title":"B","revisions":[{"revid":20,"timestamp":"2024-01-01T00:00:00Z","slots":{"main":{"content":"b"}}}]}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	pages, err := client.GetPages("A", "B")
+	if err != nil {
+		t.Fatalf("GetPages returned error: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("made %d requests, want 2", requests)
+	}
+	for title, want := range map[string]int{"A": 10, "B": 20} {
+		page := pages[title]
+		if page.Error != nil {
+			t.Errorf("unexpected error for %s: %v", title, page.Error)
+		}
+		if page.RevID != want || page.Content() != strings.ToLower(title) {
+			t.Errorf("unexpected page %s: %+v", title, page)
+		}
+	}
+}
+
+// batchHandler returns an HTTP handler that responds to userinfo requests
+// with the given rights and to page requests with a page for each title.
+func batchHandler(rights string, batchSizes *[]int, mu *sync.Mutex) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.Form.Get("meta") == "userinfo" {
+			fmt.Fprintf(w, `{"batchcomplete":true,"query":{"userinfo":{"id":1,"name":"Bot","rights":[%s]}}}`, rights)
+			return
+		}
+
+		titles := strings.Split(r.Form.Get("titles"), "|")
+		mu.Lock()
+		*batchSizes = append(*batchSizes, len(titles))
+		mu.Unlock()
+
+		var pages []string
+		for i, title := range titles {
+			pages = append(pages, fmt.Sprintf(`{"pageid":%d,"ns":0,"title":%q,
+			"revisions":[{"timestamp":"2024-01-01T00:00:00Z","slots":{"main":{"content":%q}}}]}`,
+				i+1, title, "content of "+title))
+		}
+		fmt.Fprintf(w, `{"batchcomplete":true,"query":{"pages":[%s]}}`, strings.Join(pages, ","))
+	}
+}
+
+func TestGetPagesByNameBatches(t *testing.T) {
+	var mu sync.Mutex
+	var batchSizes []int
+	server, client := setup(batchHandler(`"read","edit"`, &batchSizes, &mu))
+	defer server.Close()
+	client.MaxConcurrentBatches = 2
+
+	var titles []string
+	for i := 0; i < 120; i++ {
+		titles = append(titles, fmt.Sprintf("Page %d", i))
+	}
+
+	pages, err := client.GetPagesByName(titles...)
+	if err != nil {
+		t.Fatalf("GetPagesByName returned error: %v", err)
+	}
+	if len(pages) != len(titles) {
+		t.Fatalf("expected %d pages, got %d", len(titles), len(pages))
+	}
+	for _, title := range titles {
+		if page := pages[title]; page.Content != "content of "+title {
+			t.Errorf("unexpected content for %s: %q", title, page.Content)
+		}
+	}
+
+	sort.Ints(batchSizes)
+	if fmt.Sprint(batchSizes) != "[20 50 50]" {
+		t.Errorf("unexpected batch sizes: %v", batchSizes)
+	}
+}
+
+func TestGetPagesByNameHighLimits(t *testing.T) {
+	var mu sync.Mutex
+	var batchSizes []int
+	server, client := setup(batchHandler(`"read","apihighlimits"`, &batchSizes, &mu))
+	defer server.Close()
+
+	var titles []string
+	for i := 0; i < 120; i++ {
+		titles = append(titles, fmt.Sprintf("Page %d", i))
+	}
+
+	pages, err := client.GetPagesByName(titles...)
+	if err != nil {
+		t.Fatalf("GetPagesByName returned error: %v", err)
+	}
+	if len(pages) != len(titles) {
+		t.Fatalf("expected %d pages, got %d", len(titles), len(pages))
+	}
+	if fmt.Sprint(batchSizes) != "[120]" {
+		t.Errorf("unexpected batch sizes: %v", batchSizes)
+	}
+}
+
+func TestEditPageRetriesAfterConflict(t *testing.T) {
+	revs := []struct {
+		id        int
+		timestamp string
+		content   string
+	}{
+		{5, "2024-01-01T00:00:00Z", "a"},
+		{6, "2024-01-01T00:00:05Z", "ab"},
+	}
+	queries, edits := 0, 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		switch r.Form.Get("action") {
+		case "query":
+			if r.Form.Get("titles") != "Page" {
+				t.Errorf("unexpected titles: %s", r.Form.Get("titles"))
+			}
+			rev := revs[queries]
+			queries++
+			fmt.Fprintf(w, `{"batchcomplete":true,"curtimestamp":"2024-01-01T00:00:1%dZ",
+			"query":{"pages":[{"pageid":1,"ns":0,"title":"Page","revisions":[{"revid":%d,
+			"parentid":4,"timestamp":%q,"slots":{"main":{"content":%q}}}]}]}}`,
+				queries, rev.id, rev.timestamp, rev.content)
+		case "edit":
+			rev := revs[edits]
+			edits++
+			if v := r.Form.Get("basetimestamp"); v != rev.timestamp {
+				t.Errorf("basetimestamp != %s: basetimestamp=%s", rev.timestamp, v)
+			}
+			if v := r.Form.Get("baserevid"); v != fmt.Sprint(rev.id) {
+				t.Errorf("baserevid != %d: baserevid=%s", rev.id, v)
+			}
+			if v := r.Form.Get("starttimestamp"); v != fmt.Sprintf("2024-01-01T00:00:1%dZ", edits) {
+				t.Errorf("unexpected starttimestamp: %s", v)
+			}
+			if v := r.Form.Get("text"); v != rev.content+"!" {
+				t.Errorf("unexpected text: %s", v)
+			}
+			if edits == 1 {
+				fmt.Fprint(w, `{"error":{"code":"editconflict","info":"Edit conflict."}}`)
+				return
+			}
+			fmt.Fprint(w, `{"edit":{"result":"Success","pageid":1,"title":"Page","newrevid":7}}`)
+		default:
+			t.Fatalf("Unexpected request: %s", r.Form.Encode())
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+
+	calls := 0
+	err := client.EditPage("Page", func(old string) (string, string, error) {
+		calls++
+		return old + "!", "exclaim", nil
+	})
+	if err != nil {
+		t.Fatalf("EditPage returned error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected transform to be called 2 times, got %d", calls)
+	}
+}
+
+func TestEditPageLargeText(t *testing.T) {
+	// Large edits are sent as multipart/form-data, which must still carry
+	// the nocreate and createonly flags.
+	text := strings.Repeat("x", maxSizeForQueryString+1000)
+	for _, exists := range []bool{true, false} {
+		httpHandler := func(w http.ResponseWriter, r *http.Request) {
+			if err := r.ParseMultipartForm(1 << 20); err != nil && err != http.ErrNotMultipart {
+				panic("Bad HTTP form")
+			}
+
+			switch r.Form.Get("action") {
+			case "query":
+				if exists {
+					fmt.Fprint(w, `{"batchcomplete":true,"curtimestamp":"2024-01-01T00:00:10Z",
+					"query":{"pages":[{"pageid":1,"ns":0,"title":"Page","revisions":[{"revid":5,
+					"timestamp":"2024-01-01T00:00:00Z","slots":{"main":{"content":"a"}}}]}]}}`)
+				} else {
+					fmt.Fprint(w, `{"batchcomplete":true,"curtimestamp":"2024-01-01T00:00:10Z",
+					"query":{"pages":[{"ns":0,"title":"Page","missing":true}]}}`)
+				}
+			case "edit":
+				if r.MultipartForm == nil {
+					t.Errorf("large edit not sent as multipart/form-data")
+				}
+				flag, other := "createonly", "nocreate"
+				if exists {
+					flag, other = other, flag
+				}
+				if v := r.Form.Get(flag); v != "1" {
+					t.Errorf("exists=%v: %s = %q, want 1", exists, flag, v)
+				}
+				if _, ok := r.Form[other]; ok {
+					t.Errorf("exists=%v: unexpected %s parameter", exists, other)
+				}
+				if v := r.Form.Get("text"); v != text {
+					t.Errorf("exists=%v: unexpected text of length %d", exists, len(v))
+				}
+				fmt.Fprint(w, `{"edit":{"result":"Success","pageid":1,"title":"Page","newrevid":7}}`)
+			default:
+				t.Fatalf("Unexpected request: %s", r.Form.Encode())
+			}
+		}
+
+		server, client := setup(httpHandler)
+		client.Tokens[CSRFToken] = "VALIDTOKEN"
+		err := client.EditPage("Page", func(old string) (string, string, error) {
+			return text, "large", nil
+		})
+		if err != nil {
+			t.Errorf("exists=%v: EditPage returned error: %v", exists, err)
+		}
+		server.Close()
+	}
+}
+
+func TestEditPageGivesUpAfterRetries(t *testing.T) {
+	edits := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.Form.Get("action") == "query" {
+			fmt.Fprint(w, `{"batchcomplete":true,"curtimestamp":"2024-01-01T00:00:10Z",
+			"query":{"pages":[{"ns":0,"title":"Page","missing":true}]}}`)
+			return
+		}
+		edits++
+		if _, ok := r.Form["createonly"]; !ok {
+			t.Errorf("createonly not set when creating page")
+		}
+		fmt.Fprint(w, `{"error":{"code":"articleexists","info":"The article you tried to create has been created already."}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	client.EditConflictRetries = 2
+
+	err := client.EditPage("Page", func(old string) (string, string, error) {
+		if old != "" {
+			t.Errorf("expected empty content for missing page, got %q", old)
+		}
+		return "new page", "create", nil
+	})
+	if err != ErrEditConflict {
+		t.Fatalf("expected ErrEditConflict, got %v", err)
+	}
+	if edits != 3 {
+		t.Errorf("expected 3 edit attempts, got %d", edits)
+	}
+}
+
+func TestAPIErrorIsErrEditConflict(t *testing.T) {
+	if !errors.Is(APIError{Code: "editconflict"}, ErrEditConflict) {
+		t.Error("editconflict APIError does not match ErrEditConflict")
+	}
+	if errors.Is(APIError{Code: "badtoken"}, ErrEditConflict) {
+		t.Error("badtoken APIError matches ErrEditConflict")
+	}
+}
+
+func TestEditWithResult(t *testing.T) {
+	resp := `{"edit":{"new":true,"result":"Success","pageid":42,"title":"PAGE",
+	"contentmodel":"wikitext","oldrevid":0,"newrevid":7950155,
+	"newtimestamp":"2015-02-12T17:13:01Z","watched":true}}`
+
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, resp)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	result, err := client.EditWithResult(params.Values{})
+	if err != nil {
+		t.Fatalf("edit request returned error: %v", err)
+	}
+	expected := EditResult{
+		PageID:       42,
+		Title:        "PAGE",
+		ContentModel: "wikitext",
+		NewRevID:     7950155,
+		NewTimestamp: "2015-02-12T17:13:01Z",
+		New:          true,
+		Watched:      true,
+	}
+	if *result != expected {
+		t.Errorf("unexpected EditResult:\n got: %+v\nwant: %+v", *result, expected)
+	}
+}
+
+func TestEditWithResultNoChange(t *testing.T) {
+	resp := `{"edit":{"result":"Success","pageid":42,"title":"PAGE",
+	"contentmodel":"wikitext","nochange":true}}`
+
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, resp)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	result, err := client.EditWithResult(params.Values{})
+	if err != nil {
+		t.Fatalf("edit request returned error: %v", err)
+	}
+	if !result.NoChange {
+		t.Error("EditResult.NoChange is false despite nochange response")
+	}
+
+	if err := client.Edit(params.Values{}); err != ErrEditNoChange {
+		t.Errorf("expected ErrEditNoChange from Edit, got %v", err)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	resp := `{"edit":{"result":"Success","pageid":42,"title":"Page",
+	"contentmodel":"wikitext","oldrevid":12,"newrevid":13,
+	"newtimestamp":"2015-02-12T17:13:01Z"}}`
+
+	want := map[string]string{
+		"action":    "edit",
+		"title":     "Page",
+		"undo":      "12",
+		"undoafter": "10",
+		"summary":   "revert",
+	}
+	server, client := setup(writeActionHandler(t, "edit", want, resp))
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	result, err := client.Undo("Page", 12, 10, "revert")
+	if err != nil {
+		t.Fatalf("undo returned error: %v", err)
+	}
+	if result.OldRevID != 12 || result.NewRevID != 13 {
+		t.Errorf("unexpected EditResult: %+v", *result)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/antonholmquist/jason"
 )
@@ -17,6 +18,26 @@ func (e APIError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Code, e.Info)
 }
 
+// Is allows APIErrors to be compared with sentinel errors that correspond
+// to API error codes, such as ErrEditConflict, using errors.Is.
+func (e APIError) Is(target error) bool {
+	return target == ErrEditConflict && e.Code == "editconflict"
+}
+
+// HTTPError is returned when the server responds to an API request with
+// an HTTP error status (4xx or 5xx) rather than an API response.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	// RetryAfter is the delay requested by the server with the
+	// Retry-After header, or zero if there was none.
+	RetryAfter time.Duration
+}
+
+func (e HTTPError) Error() string {
+	return fmt.Sprintf("HTTP error: %s", e.Status)
+}
+
 // APIWarnings represents a collection of MediaWiki API warnings.
 type APIWarnings []struct {
 	Module, Info string
@@ -63,6 +84,31 @@ func (e CaptchaError) Error() string {
 	}
 }
 
+// ClientLoginError is returned by Client.ClientLogin when the login did not
+// succeed. Status is the status returned by the API:
+//
+//	FAIL     - the login failed, e.g. because of a wrong password
+//	UI       - additional information is required, but no prompter was given
+//	REDIRECT - the login must be completed by visiting RedirectTarget
+//	RESTART  - the login succeeded, but the account is not linked to
+//	           a local account
+type ClientLoginError struct {
+	Status         string
+	Message        string
+	MessageCode    string
+	RedirectTarget string
+}
+
+func (e ClientLoginError) Error() string {
+	if e.RedirectTarget != "" {
+		return fmt.Sprintf("clientlogin %s: %s (redirect to %s)", e.Status, e.Message, e.RedirectTarget)
+	}
+	if e.MessageCode != "" {
+		return fmt.Sprintf("clientlogin %s: %s: %s", e.Status, e.MessageCode, e.Message)
+	}
+	return fmt.Sprintf("clientlogin %s: %s", e.Status, e.Message)
+}
+
 // maxLagError is returned by the callf closure in the Client.call method when
 // there is too much lag on the MediaWiki site. maxLagError contains a message
 // from the server in the format "Waiting for $host: $lag seconds lagged\n" and
@@ -85,6 +131,13 @@ var ErrAPIBusy = errors.New("the API is too busy. Try again later")
 // no arguments are passed.
 var ErrNoArgs = errors.New("no arguments passed")
 
+// isBadTokenError reports whether err is an APIError signifying that the
+// token sent with the request was invalid or missing.
+func isBadTokenError(err error) bool {
+	apierr, ok := err.(APIError)
+	return ok && (apierr.Code == "badtoken" || apierr.Code == "notoken")
+}
+
 // extractAPIErrors extracts API errors or warnings from a given
 // *jason.Object. If it finds an error, it will return an APIError.
 // Otherwise it will look for warnings, and if it finds any it will return
@@ -1,6 +1,6 @@
 module cgt.name/pkg/go-mwclient
 
-go 1.20
+go 1.23.0
 
 require (
 	github.com/antonholmquist/jason v1.0.0
@@ -0,0 +1,66 @@
+// Package redact removes secrets (passwords, tokens, authorization headers
+// and cookies) from API requests and responses before they are written to
+// debug dumps or test cassettes.
+package redact
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secret values.
+const Redacted = "[REDACTED]"
+
+// IsSecretParam reports whether the value of the parameter key is secret.
+// Passwords and all tokens (token, lgtoken, logintoken, OATHToken etc.)
+// are secret.
+func IsSecretParam(key string) bool {
+	key = strings.ToLower(key)
+	switch key {
+	case "lgpassword", "password", "retype":
+		return true
+	}
+	return strings.HasSuffix(key, "token")
+}
+
+// Params returns a copy of p with secret values redacted.
+func Params[M ~map[string]string](p M) M {
+	r := make(M, len(p))
+	for k, v := range p {
+		if IsSecretParam(k) {
+			v = Redacted
+		}
+		r[k] = v
+	}
+	return r
+}
+
+// SecretHeaders are the HTTP headers whose values are secret.
+var SecretHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"Www-Authenticate",
+}
+
+// Header returns a copy of h with secret values redacted.
+func Header(h http.Header) http.Header {
+	r := h.Clone()
+	for _, k := range SecretHeaders {
+		if _, ok := r[k]; ok {
+			r[k] = []string{Redacted}
+		}
+	}
+	return r
+}
+
+// secretJSONRe matches JSON object members whose values are tokens,
+// such as those in responses to meta=tokens requests.
+var secretJSONRe = regexp.MustCompile(`("[A-Za-z_]*token"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// Body returns a copy of the JSON response body b with tokens redacted.
+func Body(b []byte) []byte {
+	return secretJSONRe.ReplaceAll(b, []byte(`$1"`+Redacted+`"`))
+}
@@ -0,0 +1,56 @@
+package redact
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParams(t *testing.T) {
+	p := map[string]string{
+		"action":     "login",
+		"lgname":     "Bot",
+		"lgpassword": "hunter2",
+		"lgtoken":    "abc+\\",
+		"OATHToken":  "123456",
+	}
+	r := Params(p)
+	for k, want := range map[string]string{
+		"action":     "login",
+		"lgname":     "Bot",
+		"lgpassword": Redacted,
+		"lgtoken":    Redacted,
+		"OATHToken":  Redacted,
+	} {
+		if r[k] != want {
+			t.Errorf("%s = %q, want %q", k, r[k], want)
+		}
+	}
+	if p["lgpassword"] != "hunter2" {
+		t.Error("Params modified its argument")
+	}
+}
+
+func TestHeader(t *testing.T) {
+	h := http.Header{}
+	h.Set("Authorization", "Bearer secret")
+	h.Set("Cookie", "session=secret")
+	h.Set("Content-Type", "application/json")
+	r := Header(h)
+	if r.Get("Authorization") != Redacted || r.Get("Cookie") != Redacted {
+		t.Errorf("secret headers not redacted: %v", r)
+	}
+	if r.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q", r.Get("Content-Type"))
+	}
+	if h.Get("Cookie") != "session=secret" {
+		t.Error("Header modified its argument")
+	}
+}
+
+func TestBody(t *testing.T) {
+	body := `{"query":{"tokens":{"csrftoken":"abc\"+\\","logintoken":"def"}},"title":"token"}`
+	want := `{"query":{"tokens":{"csrftoken":"[REDACTED]","logintoken":"[REDACTED]"}},"title":"token"}`
+	if got := string(Body([]byte(body))); got != want {
+		t.Errorf("Body =\n%s\nwant\n%s", got, want)
+	}
+}
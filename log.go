@@ -0,0 +1,133 @@
+package mwclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"time"
+
+	"cgt.name/pkg/go-mwclient/internal/redact"
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// SetLogger sets a logger to which the Client writes a structured record
+// for every API call. To disable, set to nil (default).
+//
+// Successful calls are logged at the debug level, failed calls (including
+// calls that returned an API error) at the warning level. Records contain
+// the attributes action, module (the query modules of action=query
+// requests), method, status (the HTTP status code of the last attempt),
+// duration, retries, maxlag_waits, and error_code or error if the call
+// failed. Request parameters and response bodies are not logged.
+func (w *Client) SetLogger(l *slog.Logger) { w.logger = l }
+
+// callStats collects information about a call for logging.
+type callStats struct {
+	attempts int
+	lagWaits int
+	status   int
+}
+
+// logCall writes a record about a call to the Client's logger.
+func (w *Client) logCall(ctx context.Context, p params.Values, post bool, resp *Response, err error, stats callStats, d time.Duration) {
+	attrs := []slog.Attr{
+		slog.String("action", p.Get("action")),
+	}
+	if module := queryModules(p); module != "" {
+		attrs = append(attrs, slog.String("module", module))
+	}
+	attrs = append(attrs,
+		slog.String("method", requestMethod(p, post)),
+		slog.Int("status", stats.status),
+		slog.Duration("duration", d),
+		slog.Int("retries", max(stats.attempts-1, 0)),
+		slog.Int("maxlag_waits", stats.lagWaits),
+	)
+
+	if err == nil {
+		err = peekAPIError(resp.Body)
+	}
+	level := slog.LevelDebug
+	if err != nil {
+		level = slog.LevelWarn
+		switch e := err.(type) {
+		case APIError:
+			attrs = append(attrs, slog.String("error_code", e.Code))
+		default:
+			attrs = append(attrs, slog.String("error", err.Error()))
+		}
+	}
+
+	w.logger.LogAttrs(ctx, level, "MediaWiki API call", attrs...)
+}
+
+// queryModules returns the query modules used by an action=query request.
+func queryModules(p params.Values) string {
+	if p.Get("action") != "query" {
+		return ""
+	}
+	var modules []string
+	for _, key := range []string{"prop", "list", "meta", "generator"} {
+		if v := p.Get(key); v != "" {
+			modules = append(modules, v)
+		}
+	}
+	return strings.Join(modules, "|")
+}
+
+// dumpRequest writes a dump of req, whose parameters are p, to the debug
+// writer with secrets redacted.
+func (w *Client) dumpRequest(req *http.Request, p params.Values) {
+	rp := redact.Params(p)
+	dreq := req.Clone(req.Context())
+	dreq.Header = redact.Header(req.Header)
+	if req.Method == "GET" {
+		dreq.URL.RawQuery = rp.Encode()
+	} else {
+		var body string
+		if strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/") {
+			var contentType string
+			var err error
+			body, contentType, err = rp.EncodeMultipart()
+			if err != nil {
+				fmt.Fprintf(w.debug, "Err dumping request: %v\n", err)
+				return
+			}
+			dreq.Header.Set("Content-Type", contentType)
+		} else {
+			body = rp.Encode()
+		}
+		dreq.Body = io.NopCloser(strings.NewReader(body))
+		dreq.ContentLength = int64(len(body))
+		dreq.GetBody = nil
+	}
+
+	reqdump, err := httputil.DumpRequestOut(dreq, true)
+	if err != nil {
+		fmt.Fprintf(w.debug, "Err dumping request: %v\n", err)
+	} else {
+		w.debug.Write(reqdump)
+	}
+}
+
+// dumpResponse writes a dump of resp, whose body is body, to the debug
+// writer with secrets redacted.
+func (w *Client) dumpResponse(resp *http.Response, body []byte) {
+	rbody := redact.Body(body)
+	dresp := *resp
+	dresp.Header = redact.Header(resp.Header)
+	dresp.Body = io.NopCloser(strings.NewReader(string(rbody)))
+	dresp.ContentLength = int64(len(rbody))
+	dresp.TransferEncoding = nil
+
+	respdump, err := httputil.DumpResponse(&dresp, true)
+	if err != nil {
+		fmt.Fprintf(w.debug, "Err dumping response: %v\n", err)
+	} else {
+		w.debug.Write(respdump)
+	}
+}
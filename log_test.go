@@ -0,0 +1,106 @@
+package mwclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+func TestLogger(t *testing.T) {
+	calls := 0
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"error":{"code":"badvalue","info":"Bad value"}}`)
+	})
+	defer server.Close()
+	client.RetryPolicy = BackoffPolicy{MaxAttempts: 2}
+
+	var buf bytes.Buffer
+	client.SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	client.Get(params.Values{"action": "query", "list": "allpages", "meta": "tokens"})
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("unable to decode log record %q: %v", buf.String(), err)
+	}
+	want := map[string]interface{}{
+		"level":        "WARN",
+		"action":       "query",
+		"module":       "allpages|tokens",
+		"method":       "GET",
+		"status":       float64(200),
+		"retries":      float64(1),
+		"maxlag_waits": float64(0),
+		"error_code":   "badvalue",
+	}
+	for k, v := range want {
+		if record[k] != v {
+			t.Errorf("%s = %v, want %v", k, record[k], v)
+		}
+	}
+	if _, ok := record["duration"]; !ok {
+		t.Error("record has no duration")
+	}
+}
+
+func TestDebugRedaction(t *testing.T) {
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "sessionsecret"})
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"tokens":{"csrftoken":"tokensecret+\\"}}}`)
+	})
+	defer server.Close()
+
+	var buf bytes.Buffer
+	client.SetDebug(&buf)
+	client.Post(params.Values{
+		"action":     "login",
+		"lgname":     "username",
+		"lgpassword": "passwordsecret",
+		"lgtoken":    "logintokensecret",
+	})
+	client.Get(params.Values{"action": "query", "meta": "tokens"})
+
+	dump := buf.String()
+	for _, secret := range []string{"passwordsecret", "logintokensecret", "sessionsecret", "tokensecret"} {
+		if strings.Contains(dump, secret) {
+			t.Errorf("debug dump contains secret %q:\n%s", secret, dump)
+		}
+	}
+	if !strings.Contains(dump, "lgname=username") {
+		t.Errorf("debug dump does not contain request parameters:\n%s", dump)
+	}
+}
+
+func TestDebugRedactionMultipart(t *testing.T) {
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"edit":{"result":"Success"}}`)
+	})
+	defer server.Close()
+
+	var buf bytes.Buffer
+	client.SetDebug(&buf)
+	client.Post(params.Values{
+		"action": "edit",
+		"text":   strings.Repeat("x", maxSizeForQueryString+1),
+		"token":  "csrftokensecret",
+	})
+
+	dump := buf.String()
+	if strings.Contains(dump, "csrftokensecret") {
+		t.Error("debug dump contains token")
+	}
+	if !strings.Contains(dump, "multipart/form-data") {
+		t.Error("debug dump does not contain multipart request")
+	}
+}
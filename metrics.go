@@ -0,0 +1,30 @@
+package mwclient
+
+import "time"
+
+// Metrics receives measurements of the API requests made by a Client.
+// It can be used to export the Client's activity to a monitoring system;
+// see the mwprometheus package for an adapter for Prometheus.
+//
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObserveRequest is called after every attempt at an API request,
+	// including retries. action is the value of the action parameter,
+	// method is the HTTP method ("GET" or "POST"), status is the HTTP status
+	// code of the response (zero if no response was received), d is how
+	// long the attempt took and bytes is the size of the response body.
+	ObserveRequest(action, method string, status int, d time.Duration, bytes int)
+	// ObserveMaxlagRetry is called every time a request is retried because
+	// the server reported that its database replication lag exceeded
+	// the maxlag parameter.
+	ObserveMaxlagRetry(action string)
+	// ObserveAPIBusy is called every time a request fails with ErrAPIBusy.
+	ObserveAPIBusy(action string)
+	// ObserveAPIError is called every time the API returns an error to
+	// Get, Post or any of the methods built on them.
+	ObserveAPIError(action, code string)
+}
+
+// SetMetrics sets the Metrics that receive measurements of the Client's
+// API requests. To disable, set to nil (default).
+func (w *Client) SetMetrics(m Metrics) { w.metrics = m }
@@ -0,0 +1,84 @@
+package mwclient
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+type testMetrics struct {
+	mu            sync.Mutex
+	requests      []string
+	maxlagRetries int
+	apiBusy       int
+	apiErrors     []string
+}
+
+func (m *testMetrics) ObserveRequest(action, method string, status int, d time.Duration, bytes int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, fmt.Sprintf("%s %s %d", action, method, status))
+}
+
+func (m *testMetrics) ObserveMaxlagRetry(action string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxlagRetries++
+}
+
+func (m *testMetrics) ObserveAPIBusy(action string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.apiBusy++
+}
+
+func (m *testMetrics) ObserveAPIError(action, code string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.apiErrors = append(m.apiErrors, action+" "+code)
+}
+
+func TestMetrics(t *testing.T) {
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		switch r.FormValue("action") {
+		case "parse":
+			w.Header().Set("X-Database-Lag", "5")
+			w.Header().Set("Retry-After", "5")
+			fmt.Fprint(w, `{"error":{"code":"maxlag","info":"Waiting for a database server"}}`)
+		case "edit":
+			fmt.Fprint(w, `{"error":{"code":"protectedpage","info":"This page has been protected."}}`)
+		default:
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{}}`)
+		}
+	})
+	defer server.Close()
+	client.Maxlag.On = true
+	m := &testMetrics{}
+	client.SetMetrics(m)
+
+	client.Get(params.Values{"action": "query"})
+	client.Post(params.Values{"action": "edit", "token": "+\\"})
+	if _, err := client.Get(params.Values{"action": "parse"}); err != ErrAPIBusy {
+		t.Fatalf("expected ErrAPIBusy, got %v", err)
+	}
+
+	wantRequests := 2 + client.Maxlag.Retries
+	if len(m.requests) != wantRequests {
+		t.Errorf("observed %d requests, want %d: %v", len(m.requests), wantRequests, m.requests)
+	} else if m.requests[0] != "query GET 200" || m.requests[1] != "edit POST 200" {
+		t.Errorf("unexpected requests: %v", m.requests)
+	}
+	if m.maxlagRetries != client.Maxlag.Retries-1 {
+		t.Errorf("observed %d maxlag retries, want %d", m.maxlagRetries, client.Maxlag.Retries-1)
+	}
+	if m.apiBusy != 1 {
+		t.Errorf("observed %d ErrAPIBusy, want 1", m.apiBusy)
+	}
+	if len(m.apiErrors) != 1 || m.apiErrors[0] != "edit protectedpage" {
+		t.Errorf("unexpected API errors: %v", m.apiErrors)
+	}
+}
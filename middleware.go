@@ -0,0 +1,167 @@
+package mwclient
+
+import (
+	"context"
+	"net/http"
+
+	"cgt.name/pkg/go-mwclient/params"
+
+	"github.com/antonholmquist/jason"
+)
+
+// Request is an API request as seen by middlewares.
+type Request struct {
+	// Context is the context the request is bound to.
+	Context context.Context
+	// Params contains the parameters of the request.
+	// Middlewares may modify them before passing the request on.
+	Params params.Values
+	// Post is true if the request will be sent as a POST request.
+	// Requests with large parameters are POSTed even if Post is false.
+	Post bool
+	// Files contains the files sent as file parts of a multipart/form-data
+	// request, e.g. by Upload. Middlewares must not read them.
+	Files []params.File
+	// Attempt is the number of the attempt at the request, starting at 1.
+	// It is greater than 1 if the request is being retried. It is zero
+	// in call middlewares (see UseCall).
+	Attempt int
+}
+
+// Response is an API response as seen by middlewares.
+type Response struct {
+	// StatusCode is the HTTP status code of the response, or zero if the
+	// response was not received over HTTP (e.g. if it was created by
+	// a middleware).
+	StatusCode int
+	// Header contains the HTTP response headers.
+	Header http.Header
+	// Body contains the raw response body.
+	Body []byte
+
+	js *jason.Object
+}
+
+// JSON decodes the response body as a *jason.Object.
+// The result is cached, so JSON may be called by several middlewares
+// without decoding the body more than once.
+// JSON does not check the response for API errors or warnings.
+func (r *Response) JSON() (*jason.Object, error) {
+	if r.js == nil {
+		js, err := jason.NewObjectFromBytes(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		r.js = js
+	}
+	return r.js, nil
+}
+
+// RoundTripFunc performs a single attempt at an API request.
+//
+// If the server responds with an HTTP error status, the error is an
+// HTTPError. API errors and warnings are not returned as errors;
+// they are contained in the Response.
+type RoundTripFunc func(req *Request) (*Response, error)
+
+// Middleware wraps a RoundTripFunc to inspect or modify requests and
+// responses. A Middleware may also return a response without calling next,
+// for example to serve a request from a cache or to intercept it in a
+// dry run.
+//
+// For example, the following middleware sets the uselang parameter on all
+// requests:
+//
+//	w.Use(func(next mwclient.RoundTripFunc) mwclient.RoundTripFunc {
+//		return func(req *mwclient.Request) (*mwclient.Response, error) {
+//			req.Params.Set("uselang", "en")
+//			return next(req)
+//		}
+//	})
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// Use adds middlewares to the Client. Middlewares are called in the order
+// they were added, after the built-in middlewares which set the format,
+// maxlag and assert parameters, and before the request is sent.
+// Middlewares are called once for every attempt at a request, including
+// retries. Use must not be called while requests are in progress.
+func (w *Client) Use(mw ...Middleware) {
+	w.middlewares = append(w.middlewares, mw...)
+}
+
+// UseCall adds call middlewares to the Client. Unlike the middlewares added
+// with Use, call middlewares are called once for every API call, around all
+// attempts at the request (including maxlag and RetryPolicy retries) rather
+// than for each attempt. The Context of the Request a call middleware passes
+// on is the context of every attempt, so call middlewares can, for example,
+// start a trace span that the spans of the attempts are children of.
+// The Response is that of the last attempt, and the error is the error
+// of the call (e.g. ErrAPIBusy).
+// Call middlewares are called in the order they were added. UseCall must
+// not be called while requests are in progress.
+func (w *Client) UseCall(mw ...Middleware) {
+	w.callMiddlewares = append(w.callMiddlewares, mw...)
+}
+
+// callRoundTripper returns the Client's call middleware chain ending in
+// the attempts at the request.
+func (w *Client) callRoundTripper() RoundTripFunc {
+	rt := w.attempts
+	for i := len(w.callMiddlewares) - 1; i >= 0; i-- {
+		rt = w.callMiddlewares[i](rt)
+	}
+	return rt
+}
+
+// roundTripper returns the Client's middleware chain ending in the
+// HTTP transport.
+func (w *Client) roundTripper() RoundTripFunc {
+	rt := w.transport
+	for i := len(w.middlewares) - 1; i >= 0; i-- {
+		rt = w.middlewares[i](rt)
+	}
+	for _, mw := range []Middleware{w.assertMiddleware, w.maxlagMiddleware, formatMiddleware} {
+		rt = mw(rt)
+	}
+	return rt
+}
+
+// formatMiddleware requests JSON responses in format version 2
+// unless another format version has been requested.
+func formatMiddleware(next RoundTripFunc) RoundTripFunc {
+	return func(req *Request) (*Response, error) {
+		p := req.Params
+		p.Set("format", "json")
+		if version := p.Get("formatversion"); version == "1" {
+			p.Set("utf8", "")
+		} else if version == "" {
+			p.Set("formatversion", "2")
+			// utf8= is implicit in formatversion=2
+		}
+		return next(req)
+	}
+}
+
+// maxlagMiddleware sets the maxlag parameter if maxlag is turned on.
+func (w *Client) maxlagMiddleware(next RoundTripFunc) RoundTripFunc {
+	return func(req *Request) (*Response, error) {
+		if w.Maxlag.On && req.Params.Get("maxlag") == "" {
+			// User has not set maxlag param manually. Use configured value.
+			req.Params.Set("maxlag", w.Maxlag.Timeout)
+		}
+		return next(req)
+	}
+}
+
+// assertMiddleware sets the assert parameter according to Client.Assert.
+func (w *Client) assertMiddleware(next RoundTripFunc) RoundTripFunc {
+	return func(req *Request) (*Response, error) {
+		switch w.Assert {
+		case AssertUser:
+			req.Params.Set("assert", "user")
+		case AssertBot:
+			req.Params.Set("assert", "bot")
+		}
+		return next(req)
+	}
+}
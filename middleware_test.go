@@ -0,0 +1,161 @@
+package mwclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+func TestMiddlewareOrderAndParams(t *testing.T) {
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.FormValue("uselang"); got != "en" {
+			t.Errorf("uselang = %q, want %q", got, "en")
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{}}`)
+	})
+	defer server.Close()
+	client.Assert = AssertUser
+
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next RoundTripFunc) RoundTripFunc {
+			return func(req *Request) (*Response, error) {
+				order = append(order, name)
+				// Built-in middlewares run first.
+				if req.Params.Get("format") != "json" || req.Params.Get("assert") != "user" {
+					t.Errorf("%s: built-in parameters not set: %v", name, req.Params)
+				}
+				resp, err := next(req)
+				order = append(order, name+" done")
+				return resp, err
+			}
+		}
+	}
+	uselang := func(next RoundTripFunc) RoundTripFunc {
+		return func(req *Request) (*Response, error) {
+			req.Params.Set("uselang", "en")
+			return next(req)
+		}
+	}
+	client.Use(trace("a"), trace("b"))
+	client.Use(uselang)
+
+	if _, err := client.Get(params.Values{"action": "query"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"a", "b", "b done", "a done"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("middleware order = %v, want %v", order, want)
+	}
+}
+
+func TestMiddlewareIntercept(t *testing.T) {
+	var calls int32
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	})
+	defer server.Close()
+
+	client.Use(func(next RoundTripFunc) RoundTripFunc {
+		return func(req *Request) (*Response, error) {
+			if req.Params.Get("action") == "edit" {
+				return &Response{Body: []byte(`{"edit":{"result":"Success","dryrun":true}}`)}, nil
+			}
+			return next(req)
+		}
+	})
+
+	resp, err := client.Post(params.Values{"action": "edit", "title": "Test", "text": "x"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dry, _ := resp.GetBoolean("edit", "dryrun"); !dry {
+		t.Errorf("expected intercepted response, got %v", resp)
+	}
+	if calls != 0 {
+		t.Errorf("expected no HTTP requests, got %d", calls)
+	}
+}
+
+func TestMiddlewareSeesDecodedResponse(t *testing.T) {
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"error":{"code":"badvalue","info":"Bad value"}}`)
+	})
+	defer server.Close()
+
+	var code string
+	client.Use(func(next RoundTripFunc) RoundTripFunc {
+		return func(req *Request) (*Response, error) {
+			resp, err := next(req)
+			if err != nil {
+				return resp, err
+			}
+			js, err := resp.JSON()
+			if err != nil {
+				return resp, err
+			}
+			code, _ = js.GetString("error", "code")
+			return resp, nil
+		}
+	})
+
+	_, err := client.Get(params.Values{"action": "query"})
+	if apierr, ok := err.(APIError); !ok || apierr.Code != "badvalue" {
+		t.Errorf("expected badvalue APIError, got %v", err)
+	}
+	if code != "badvalue" {
+		t.Errorf("middleware saw error code %q, want %q", code, "badvalue")
+	}
+}
+
+type callKey struct{}
+
+func TestCallMiddleware(t *testing.T) {
+	var requests int32
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("X-Database-Lag", "10")
+			w.Header().Set("Retry-After", "1")
+			fmt.Fprint(w, `{"error":{"code":"maxlag","info":"Waiting for a database server"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{}}`)
+	})
+	defer server.Close()
+	client.sleep = noSleep
+	client.Maxlag.On = true
+
+	var order []string
+	client.UseCall(func(next RoundTripFunc) RoundTripFunc {
+		return func(req *Request) (*Response, error) {
+			order = append(order, fmt.Sprintf("call %d", req.Attempt))
+			r := *req
+			r.Context = context.WithValue(req.Context, callKey{}, "call")
+			resp, err := next(&r)
+			order = append(order, "call done")
+			return resp, err
+		}
+	})
+	client.Use(func(next RoundTripFunc) RoundTripFunc {
+		return func(req *Request) (*Response, error) {
+			if v := req.Context.Value(callKey{}); v != "call" {
+				t.Errorf("attempt %d: context not passed on by call middleware", req.Attempt)
+			}
+			order = append(order, fmt.Sprintf("attempt %d", req.Attempt))
+			return next(req)
+		}
+	})
+
+	if _, err := client.Get(params.Values{"action": "query"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"call 0", "attempt 1", "attempt 2", "call done"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("middleware order = %v, want %v", order, want)
+	}
+}
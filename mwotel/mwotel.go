@@ -0,0 +1,175 @@
+// Package mwotel traces go-mwclient API requests with OpenTelemetry.
+//
+// It is a separate module so that go-mwclient itself does not depend on
+// OpenTelemetry.
+//
+//	w.UseCall(mwotel.CallMiddleware())
+//	w.Use(mwotel.Middleware())
+//
+// Every API call creates a span, and every attempt at the request,
+// including each maxlag or RetryPolicy retry, creates a child span of it.
+// Call spans are children of the span in the context passed to the
+// Context variants of the Client methods (e.g. GetContext), and the
+// context of the attempt span is passed on to the HTTP request.
+package mwotel
+
+import (
+	"errors"
+	"strings"
+
+	"cgt.name/pkg/go-mwclient"
+	"cgt.name/pkg/go-mwclient/params"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the name of the tracer used by CallMiddleware and
+// Middleware.
+const tracerName = "cgt.name/pkg/go-mwclient/mwotel"
+
+// These are the keys of the span attributes set by CallMiddleware and
+// Middleware.
+const (
+	ActionKey     = attribute.Key("mediawiki.action")
+	ListKey       = attribute.Key("mediawiki.list")
+	PropKey       = attribute.Key("mediawiki.prop")
+	GeneratorKey  = attribute.Key("mediawiki.generator")
+	TitleCountKey = attribute.Key("mediawiki.title_count")
+	AttemptKey    = attribute.Key("mediawiki.attempt")
+	ErrorCodeKey  = attribute.Key("mediawiki.error_code")
+	StatusCodeKey = attribute.Key("http.response.status_code")
+)
+
+// queryParams are the parameters recorded as span attributes.
+var queryParams = []struct {
+	name string
+	key  attribute.Key
+}{
+	{"list", ListKey},
+	{"prop", PropKey},
+	{"generator", GeneratorKey},
+}
+
+// Option configures CallMiddleware and Middleware.
+type Option func(*config)
+
+type config struct {
+	tp trace.TracerProvider
+}
+
+// WithTracerProvider sets the TracerProvider used to create spans.
+// By default, the global TracerProvider is used.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) { c.tp = tp }
+}
+
+// CallMiddleware returns a mwclient.Middleware that creates a span for every
+// API call. It must be added with Client.UseCall. The spans are named
+// "MediaWiki API <action>" and are the parents of the spans created by
+// Middleware for the attempts at the request. They have the same
+// attributes as the spans of the attempts, except for mediawiki.attempt,
+// and describe the outcome of the last attempt.
+func CallMiddleware(opts ...Option) mwclient.Middleware {
+	tracer := newTracer(opts)
+	return func(next mwclient.RoundTripFunc) mwclient.RoundTripFunc {
+		return func(req *mwclient.Request) (*mwclient.Response, error) {
+			action := req.Params.Get("action")
+			ctx, span := tracer.Start(req.Context, "MediaWiki API "+action,
+				trace.WithSpanKind(trace.SpanKindInternal),
+				trace.WithAttributes(requestAttributes(req.Params)...))
+			defer span.End()
+
+			r := *req
+			r.Context = ctx
+			resp, err := next(&r)
+			recordResult(span, resp, err)
+			return resp, err
+		}
+	}
+}
+
+// Middleware returns a mwclient.Middleware that creates a span for every
+// attempt at an API request. It must be added with Client.Use. The spans
+// are named "MediaWiki API <action> attempt" and have the following
+// attributes:
+//
+//   - mediawiki.action, mediawiki.list, mediawiki.prop and
+//     mediawiki.generator: the values of the corresponding parameters,
+//     if they are set
+//   - mediawiki.title_count: the number of titles in the titles parameter,
+//     if it is set
+//   - mediawiki.attempt: the number of the attempt, starting at 1
+//   - http.response.status_code: the HTTP status code of the response
+//   - mediawiki.error_code: the API error code, if the API returned an error
+//
+// Spans of attempts that failed or returned an API error have the
+// status codes.Error. If CallMiddleware is used as well, the spans are
+// children of the span of the call.
+func Middleware(opts ...Option) mwclient.Middleware {
+	tracer := newTracer(opts)
+	return func(next mwclient.RoundTripFunc) mwclient.RoundTripFunc {
+		return func(req *mwclient.Request) (*mwclient.Response, error) {
+			attrs := append(requestAttributes(req.Params), AttemptKey.Int(req.Attempt))
+			ctx, span := tracer.Start(req.Context, "MediaWiki API "+req.Params.Get("action")+" attempt",
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attrs...))
+			defer span.End()
+
+			r := *req
+			r.Context = ctx
+			resp, err := next(&r)
+			recordResult(span, resp, err)
+			return resp, err
+		}
+	}
+}
+
+// newTracer returns the tracer configured by opts.
+func newTracer(opts []Option) trace.Tracer {
+	c := config{tp: otel.GetTracerProvider()}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c.tp.Tracer(tracerName)
+}
+
+// requestAttributes returns the span attributes describing the request
+// with the parameters p.
+func requestAttributes(p params.Values) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{ActionKey.String(p.Get("action"))}
+	for _, param := range queryParams {
+		if v := p.Get(param.name); v != "" {
+			attrs = append(attrs, param.key.String(v))
+		}
+	}
+	if titles := p.Get("titles"); titles != "" {
+		attrs = append(attrs, TitleCountKey.Int(strings.Count(titles, "|")+1))
+	}
+	return attrs
+}
+
+// recordResult records the HTTP status code, the error and the API error
+// code of a response on span.
+func recordResult(span trace.Span, resp *mwclient.Response, err error) {
+	var httpErr mwclient.HTTPError
+	switch {
+	case resp != nil && resp.StatusCode != 0:
+		span.SetAttributes(StatusCodeKey.Int(resp.StatusCode))
+	case errors.As(err, &httpErr):
+		span.SetAttributes(StatusCodeKey.Int(httpErr.StatusCode))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	if js, jsErr := resp.JSON(); jsErr == nil {
+		if code, codeErr := js.GetString("error", "code"); codeErr == nil {
+			span.SetAttributes(ErrorCodeKey.String(code))
+			span.SetStatus(codes.Error, code)
+		}
+	}
+}
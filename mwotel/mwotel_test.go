@@ -0,0 +1,130 @@
+package mwotel
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cgt.name/pkg/go-mwclient"
+	"cgt.name/pkg/go-mwclient/params"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMiddleware(t *testing.T) {
+	lagged := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("action") == "edit" {
+			fmt.Fprint(w, `{"error":{"code":"protectedpage","info":"This page has been protected."}}`)
+			return
+		}
+		if !lagged {
+			lagged = true
+			w.Header().Set("X-Database-Lag", "1")
+			w.Header().Set("Retry-After", "0")
+			fmt.Fprint(w, `{"error":{"code":"maxlag","info":"Waiting for a database server"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{}}`)
+	}))
+	defer server.Close()
+	w, err := mwclient.New(server.URL, "mwotel test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Maxlag.On = true
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	w.UseCall(CallMiddleware(WithTracerProvider(tp)))
+	w.Use(Middleware(WithTracerProvider(tp)))
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	if _, err := w.GetContext(ctx, params.Values{
+		"action": "query",
+		"prop":   "revisions",
+		"titles": "A|B|C",
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w.PostContext(ctx, params.Values{"action": "edit", "token": "+\\"})
+	parent.End()
+
+	// Spans are exported when they end: the attempts of the query, the
+	// query call, the attempt of the edit, the edit call and the parent.
+	spans := exporter.GetSpans()
+	if len(spans) != 6 {
+		t.Fatalf("got %d spans, want 6", len(spans))
+	}
+	queryCall, editCall := spans[2], spans[4]
+	for i, span := range []tracetest.SpanStub{queryCall, editCall} {
+		if span.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("call span %d is not a child of the parent span", i)
+		}
+	}
+	for i, span := range spans[:2] {
+		if span.Parent.SpanID() != queryCall.SpanContext.SpanID() {
+			t.Errorf("query attempt span %d is not a child of the call span", i)
+		}
+	}
+	if spans[3].Parent.SpanID() != editCall.SpanContext.SpanID() {
+		t.Error("edit attempt span is not a child of the call span")
+	}
+
+	if queryCall.Name != "MediaWiki API query" {
+		t.Errorf("call span name = %q", queryCall.Name)
+	}
+	checkAttributes(t, queryCall, map[attribute.Key]attribute.Value{
+		ActionKey:     attribute.StringValue("query"),
+		PropKey:       attribute.StringValue("revisions"),
+		TitleCountKey: attribute.IntValue(3),
+		StatusCodeKey: attribute.IntValue(200),
+	})
+	if queryCall.Status.Code == codes.Error {
+		t.Errorf("call span has error status: %v", queryCall.Status)
+	}
+
+	retry := spans[1]
+	if retry.Name != "MediaWiki API query attempt" {
+		t.Errorf("span name = %q", retry.Name)
+	}
+	want := map[attribute.Key]attribute.Value{
+		ActionKey:     attribute.StringValue("query"),
+		PropKey:       attribute.StringValue("revisions"),
+		TitleCountKey: attribute.IntValue(3),
+		AttemptKey:    attribute.IntValue(2),
+		StatusCodeKey: attribute.IntValue(200),
+	}
+	checkAttributes(t, retry, want)
+	if retry.Status.Code == codes.Error {
+		t.Errorf("retry span has error status: %v", retry.Status)
+	}
+
+	for _, edit := range []tracetest.SpanStub{spans[3], editCall} {
+		checkAttributes(t, edit, map[attribute.Key]attribute.Value{
+			ActionKey:    attribute.StringValue("edit"),
+			ErrorCodeKey: attribute.StringValue("protectedpage"),
+		})
+		if edit.Status.Code != codes.Error {
+			t.Errorf("%s: status = %v, want error", edit.Name, edit.Status)
+		}
+	}
+}
+
+func checkAttributes(t *testing.T, span tracetest.SpanStub, want map[attribute.Key]attribute.Value) {
+	t.Helper()
+	got := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes {
+		got[kv.Key] = kv.Value
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: %s = %v, want %v", span.Name, k, got[k].Emit(), v.Emit())
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Package mwprometheus exports the measurements of go-mwclient Clients as
+// Prometheus metrics.
+//
+// It is a separate module so that go-mwclient itself does not depend on
+// the Prometheus client library.
+//
+//	m := mwprometheus.New(mwprometheus.Opts{
+//		ConstLabels: prometheus.Labels{"bot": "ExampleBot"},
+//	})
+//	prometheus.MustRegister(m)
+//	w.SetMetrics(m)
+package mwprometheus
+
+import (
+	"strconv"
+	"time"
+
+	"cgt.name/pkg/go-mwclient"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Opts configures the metrics created by New.
+type Opts struct {
+	// Namespace is the prefix of the metric names.
+	// If it is empty, "mwclient" is used.
+	Namespace string
+	// ConstLabels are added to all metrics. They can be used to tell apart
+	// several Clients registered with the same registry.
+	ConstLabels prometheus.Labels
+	// Buckets are the buckets of the request duration histogram, in seconds.
+	// If it is nil, prometheus.DefBuckets is used.
+	Buckets []float64
+}
+
+// Metrics implements mwclient.Metrics and prometheus.Collector.
+// It exports the following metrics (with the default namespace):
+//
+//   - mwclient_requests_total{action,method,status}
+//   - mwclient_request_duration_seconds{action,method}
+//   - mwclient_response_bytes_total{action,method}
+//   - mwclient_maxlag_retries_total{action}
+//   - mwclient_api_busy_total{action}
+//   - mwclient_api_errors_total{action,code}
+//
+// The status label is "0" for requests that received no response.
+type Metrics struct {
+	requests      *prometheus.CounterVec
+	duration      *prometheus.HistogramVec
+	bytes         *prometheus.CounterVec
+	maxlagRetries *prometheus.CounterVec
+	apiBusy       *prometheus.CounterVec
+	apiErrors     *prometheus.CounterVec
+}
+
+var _ mwclient.Metrics = (*Metrics)(nil)
+
+// New returns a new Metrics. It must be registered with a
+// prometheus.Registerer to be exported.
+func New(opts Opts) *Metrics {
+	if opts.Namespace == "" {
+		opts.Namespace = "mwclient"
+	}
+	counter := func(name, help string, labels ...string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        name,
+			Help:        help,
+			ConstLabels: opts.ConstLabels,
+		}, labels)
+	}
+	return &Metrics{
+		requests: counter("requests_total",
+			"Number of attempts at MediaWiki API requests, including retries.",
+			"action", "method", "status"),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Name:        "request_duration_seconds",
+			Help:        "Duration of attempts at MediaWiki API requests.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     opts.Buckets,
+		}, []string{"action", "method"}),
+		bytes: counter("response_bytes_total",
+			"Size of MediaWiki API response bodies.",
+			"action", "method"),
+		maxlagRetries: counter("maxlag_retries_total",
+			"Number of MediaWiki API requests retried because of maxlag.",
+			"action"),
+		apiBusy: counter("api_busy_total",
+			"Number of MediaWiki API requests that gave up after too many maxlag retries.",
+			"action"),
+		apiErrors: counter("api_errors_total",
+			"Number of errors returned by the MediaWiki API, by error code.",
+			"action", "code"),
+	}
+}
+
+// ObserveRequest implements mwclient.Metrics.
+func (m *Metrics) ObserveRequest(action, method string, status int, d time.Duration, bytes int) {
+	m.requests.WithLabelValues(action, method, strconv.Itoa(status)).Inc()
+	m.duration.WithLabelValues(action, method).Observe(d.Seconds())
+	m.bytes.WithLabelValues(action, method).Add(float64(bytes))
+}
+
+// ObserveMaxlagRetry implements mwclient.Metrics.
+func (m *Metrics) ObserveMaxlagRetry(action string) {
+	m.maxlagRetries.WithLabelValues(action).Inc()
+}
+
+// ObserveAPIBusy implements mwclient.Metrics.
+func (m *Metrics) ObserveAPIBusy(action string) {
+	m.apiBusy.WithLabelValues(action).Inc()
+}
+
+// ObserveAPIError implements mwclient.Metrics.
+func (m *Metrics) ObserveAPIError(action, code string) {
+	m.apiErrors.WithLabelValues(action, code).Inc()
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.requests, m.duration, m.bytes, m.maxlagRetries, m.apiBusy, m.apiErrors}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
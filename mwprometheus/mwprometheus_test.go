@@ -0,0 +1,51 @@
+package mwprometheus
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cgt.name/pkg/go-mwclient"
+	"cgt.name/pkg/go-mwclient/params"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("action") == "edit" {
+			fmt.Fprint(w, `{"error":{"code":"protectedpage","info":"This page has been protected."}}`)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{}}`)
+	}))
+	defer server.Close()
+	w, err := mwclient.New(server.URL, "mwprometheus test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := New(Opts{ConstLabels: prometheus.Labels{"bot": "test"}})
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(m)
+	w.SetMetrics(m)
+
+	w.Get(params.Values{"action": "query"})
+	w.Get(params.Values{"action": "query"})
+	w.Post(params.Values{"action": "edit", "token": "+\\"})
+
+	if got := testutil.ToFloat64(m.requests.WithLabelValues("query", "GET", "200")); got != 2 {
+		t.Errorf("query requests = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.apiErrors.WithLabelValues("edit", "protectedpage")); got != 1 {
+		t.Errorf("protectedpage errors = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.bytes.WithLabelValues("query", "GET")); got == 0 {
+		t.Error("no response bytes recorded")
+	}
+	if n, err := testutil.GatherAndCount(reg); err != nil || n == 0 {
+		t.Errorf("GatherAndCount = %d, %v", n, err)
+	}
+}
@@ -0,0 +1,611 @@
+package mwtest
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sessionCookie is the name of the session cookie set by a Wiki.
+const sessionCookie = "mwtest_session"
+
+// timestampFormat is the format of timestamps in API responses.
+const timestampFormat = "2006-01-02T15:04:05Z"
+
+// anonUser is the name under which anonymous edits are saved.
+const anonUser = "127.0.0.1"
+
+// object is a JSON object in an API response.
+type object = map[string]interface{}
+
+// apiError is an API error response.
+type apiError struct {
+	code, info string
+}
+
+func (e apiError) response() object {
+	return object{"error": object{"code": e.code, "info": e.info}}
+}
+
+// request is an API request being handled.
+type request struct {
+	p    url.Values
+	post bool
+	sess *session
+}
+
+// ServeHTTP implements http.Handler by serving the MediaWiki Action API.
+func (w *Wiki) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	req := &request{
+		p:    r.Form,
+		post: r.Method == http.MethodPost,
+		sess: w.session(rw, r),
+	}
+	action := req.p.Get("action")
+
+	if maxlag := req.p.Get("maxlag"); maxlag != "" {
+		if n, err := strconv.Atoi(maxlag); err == nil && w.lag > n {
+			rw.Header().Set("X-Database-Lag", itoa(w.lag))
+			rw.Header().Set("Retry-After", itoa(w.lag))
+			writeJSON(rw, object{"error": object{
+				"code": "maxlag",
+				"info": fmt.Sprintf("Waiting for mwtest: %d seconds lagged.", w.lag),
+				"host": "mwtest",
+				"lag":  w.lag,
+			}})
+			return
+		}
+	}
+
+	if f, ok := w.takeFailure(action); ok {
+		if f.status != 0 {
+			rw.WriteHeader(f.status)
+			return
+		}
+		writeJSON(rw, apiError{f.code, f.info}.response())
+		return
+	}
+
+	if format := req.p.Get("format"); format != "json" {
+		writeJSON(rw, apiError{"badvalue", `Only format=json is supported by mwtest.`}.response())
+		return
+	}
+	if req.p.Get("formatversion") != "2" {
+		writeJSON(rw, apiError{"badvalue", `Only formatversion=2 is supported by mwtest.`}.response())
+		return
+	}
+
+	switch req.p.Get("assert") {
+	case "user":
+		if req.sess.user == nil {
+			writeJSON(rw, apiError{"assertuserfailed", "You are no longer logged in, so the action could not be completed."}.response())
+			return
+		}
+	case "bot":
+		if req.sess.user == nil || !req.sess.user.hasRight("bot") {
+			writeJSON(rw, apiError{"assertbotfailed", `You do not have the "bot" right, so the action could not be completed.`}.response())
+			return
+		}
+	}
+
+	var resp object
+	var err *apiError
+	switch action {
+	case "query":
+		resp, err = w.query(req)
+	case "login":
+		resp, err = w.login(req)
+	case "clientlogin":
+		resp, err = w.clientLogin(req)
+	case "logout":
+		resp, err = w.logout(req)
+	case "edit":
+		resp, err = w.edit(req)
+	default:
+		err = &apiError{"badvalue", fmt.Sprintf(`Unrecognized value for parameter "action": %s.`, action)}
+	}
+	if err != nil {
+		resp = err.response()
+	}
+	writeJSON(rw, resp)
+}
+
+func writeJSON(rw http.ResponseWriter, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(v)
+}
+
+// session returns the session of the request, starting a new one if
+// necessary.
+func (w *Wiki) session(rw http.ResponseWriter, r *http.Request) *session {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if s, ok := w.sessions[c.Value]; ok {
+			return s
+		}
+	}
+	id := randomHex()
+	s := &session{loginToken: randomHex() + "+\\"}
+	w.sessions[id] = s
+	http.SetCookie(rw, &http.Cookie{Name: sessionCookie, Value: id, Path: "/", HttpOnly: true})
+	return s
+}
+
+// csrf returns the CSRF token of the session. The CSRF token of
+// anonymous users is "+\".
+func (s *session) csrf() string {
+	if s.user == nil {
+		return "+\\"
+	}
+	return s.csrfToken
+}
+
+// checkToken checks the token parameter of a write request.
+func checkToken(req *request, want string) *apiError {
+	if !req.post {
+		return &apiError{"mustbeposted", fmt.Sprintf(`The "%s" module requires a POST request.`, req.p.Get("action"))}
+	}
+	token, ok := req.p["token"]
+	if !ok {
+		return &apiError{"missingparam", `The "token" parameter must be set.`}
+	}
+	if token[0] != want {
+		return &apiError{"badtoken", "Invalid CSRF token."}
+	}
+	return nil
+}
+
+func (w *Wiki) login(req *request) (object, *apiError) {
+	if !req.post {
+		return nil, &apiError{"mustbeposted", `The "login" module requires a POST request.`}
+	}
+	result := func(r object) (object, *apiError) { return object{"login": r}, nil }
+	if req.p.Get("lgtoken") == "" {
+		return result(object{"result": "NeedToken", "token": req.sess.loginToken})
+	}
+	if req.p.Get("lgtoken") != req.sess.loginToken {
+		return result(object{"result": "WrongToken"})
+	}
+	u, ok := w.users[normalizeTitle(req.p.Get("lgname"))]
+	if !ok || u.password != req.p.Get("lgpassword") {
+		return result(object{
+			"result": "Failed",
+			"reason": "Incorrect username or password entered. Please try again.",
+		})
+	}
+	w.startUserSession(req.sess, u)
+	return result(object{"result": "Success", "lguserid": u.id, "lgusername": u.name})
+}
+
+func (w *Wiki) clientLogin(req *request) (object, *apiError) {
+	if err := checkLoginToken(req); err != nil {
+		return nil, err
+	}
+	if req.p.Get("loginreturnurl") == "" && req.p.Get("logincontinue") == "" {
+		return nil, &apiError{"missingparam", `Either the "loginreturnurl" parameter or the "logincontinue" parameter must be set.`}
+	}
+	u, ok := w.users[normalizeTitle(req.p.Get("username"))]
+	if !ok || u.password != req.p.Get("password") {
+		return object{"clientlogin": object{
+			"status":      "FAIL",
+			"message":     "Incorrect username or password entered. Please try again.",
+			"messagecode": "wrongpassword",
+		}}, nil
+	}
+	w.startUserSession(req.sess, u)
+	return object{"clientlogin": object{"status": "PASS", "username": u.name}}, nil
+}
+
+func checkLoginToken(req *request) *apiError {
+	if !req.post {
+		return &apiError{"mustbeposted", fmt.Sprintf(`The "%s" module requires a POST request.`, req.p.Get("action"))}
+	}
+	if req.p.Get("logintoken") != req.sess.loginToken {
+		return &apiError{"badtoken", "Invalid CSRF token."}
+	}
+	return nil
+}
+
+func (w *Wiki) startUserSession(s *session, u *user) {
+	s.user = u
+	s.csrfToken = randomHex() + "+\\"
+	s.loginToken = randomHex() + "+\\"
+}
+
+// logout logs the session out. Unlike MediaWiki, it does not require
+// a token.
+func (w *Wiki) logout(req *request) (object, *apiError) {
+	if _, ok := req.p["token"]; ok {
+		if err := checkToken(req, req.sess.csrf()); err != nil {
+			return nil, err
+		}
+	}
+	req.sess.user = nil
+	req.sess.csrfToken = ""
+	return object{}, nil
+}
+
+func (w *Wiki) edit(req *request) (object, *apiError) {
+	if err := checkToken(req, req.sess.csrf()); err != nil {
+		return nil, err
+	}
+	p := req.p
+
+	var pg *page
+	var title string
+	if pageid := p.Get("pageid"); pageid != "" {
+		id, _ := strconv.Atoi(pageid)
+		var ok bool
+		if pg, ok = w.pagesByID[id]; !ok {
+			return nil, &apiError{"nosuchpageid", fmt.Sprintf("There is no page with ID %s.", pageid)}
+		}
+		title = pg.title
+	} else if t := p.Get("title"); t != "" {
+		title = normalizeTitle(t)
+		pg = w.pages[title]
+	} else {
+		return nil, &apiError{"missingparam", `One of the parameters "title" and "pageid" is required.`}
+	}
+
+	if w.captcha != nil && (p.Get("captchaid") != w.captcha.id || p.Get("captchaword") != w.captcha.answer) {
+		return object{"edit": object{
+			"result": "Failure",
+			"captcha": object{
+				"type":     "simple",
+				"mime":     "text/plain",
+				"id":       w.captcha.id,
+				"question": w.captcha.question,
+			},
+		}}, nil
+	}
+
+	if pg == nil {
+		if _, ok := p["nocreate"]; ok {
+			return nil, &apiError{"missingtitle", "The page you specified doesn't exist."}
+		}
+	} else {
+		if _, ok := p["createonly"]; ok {
+			return nil, &apiError{"articleexists", "The article you tried to create has been created already."}
+		}
+		latest := pg.latest()
+		if baserevid := p.Get("baserevid"); baserevid != "" && baserevid != itoa(latest.ID) {
+			return nil, &apiError{"editconflict", "Edit conflict."}
+		}
+		if base := p.Get("basetimestamp"); base != "" && base != latest.Timestamp.Format(timestampFormat) {
+			return nil, &apiError{"editconflict", "Edit conflict."}
+		}
+	}
+
+	var old string
+	if pg != nil {
+		old = pg.latest().Content
+	}
+	var content string
+	if text, ok := p["text"]; ok {
+		content = text[0]
+	} else if _, ok := p["appendtext"]; ok || p.Get("prependtext") != "" {
+		content = p.Get("prependtext") + old + p.Get("appendtext")
+	} else {
+		return nil, &apiError{"missingparam", `The "text", "appendtext" and "prependtext" parameters are all unset.`}
+	}
+
+	result := object{
+		"result":       "Success",
+		"title":        title,
+		"contentmodel": "wikitext",
+	}
+	if pg != nil && content == old {
+		result["pageid"] = pg.id
+		result["nochange"] = true
+		return object{"edit": result}, nil
+	}
+
+	username := anonUser
+	if req.sess.user != nil {
+		username = req.sess.user.name
+	}
+	_, minor := p["minor"]
+	rev := w.saveRevision(title, content, username, p.Get("summary"), minor && pg != nil)
+	result["pageid"] = w.pages[title].id
+	result["oldrevid"] = rev.ParentID
+	result["newrevid"] = rev.ID
+	result["newtimestamp"] = rev.Timestamp.Format(timestampFormat)
+	if pg == nil {
+		result["new"] = true
+	}
+	return object{"edit": result}, nil
+}
+
+func (w *Wiki) query(req *request) (object, *apiError) {
+	p := req.p
+	query := object{}
+	resp := object{"batchcomplete": true}
+	if _, ok := p["curtimestamp"]; ok {
+		resp["curtimestamp"] = w.Now().UTC().Format(timestampFormat)
+	}
+
+	for _, meta := range splitMulti(p.Get("meta")) {
+		switch meta {
+		case "tokens":
+			tokens := object{}
+			for _, t := range splitMulti(p.Get("type")) {
+				if t == "login" {
+					tokens["logintoken"] = req.sess.loginToken
+				} else {
+					tokens[t+"token"] = req.sess.csrf()
+				}
+			}
+			if len(tokens) == 0 {
+				tokens["csrftoken"] = req.sess.csrf()
+			}
+			query["tokens"] = tokens
+		case "userinfo":
+			query["userinfo"] = userInfo(req.sess.user, splitMulti(p.Get("uiprop")))
+		default:
+			return nil, &apiError{"badvalue", fmt.Sprintf(`Unrecognized value for parameter "meta": %s.`, meta)}
+		}
+	}
+
+	for _, list := range splitMulti(p.Get("list")) {
+		if list != "allpages" {
+			return nil, &apiError{"badvalue", fmt.Sprintf(`Unrecognized value for parameter "list": %s.`, list)}
+		}
+		pages, cont, err := w.allPages(p, "ap")
+		if err != nil {
+			return nil, err
+		}
+		var results []object
+		for _, pg := range pages {
+			results = append(results, object{"pageid": pg.id, "ns": pg.ns, "title": pg.title})
+		}
+		query["allpages"] = results
+		if cont != "" {
+			resp["continue"] = object{"apcontinue": cont, "continue": "-||"}
+		}
+	}
+
+	var pages []object
+	var normalized []object
+	switch {
+	case p.Get("generator") != "":
+		if gen := p.Get("generator"); gen != "allpages" {
+			return nil, &apiError{"badvalue", fmt.Sprintf(`Unrecognized value for parameter "generator": %s.`, gen)}
+		}
+		gpages, cont, err := w.allPages(p, "gap")
+		if err != nil {
+			return nil, err
+		}
+		for _, pg := range gpages {
+			pages = append(pages, object{"pageid": pg.id, "ns": pg.ns, "title": pg.title})
+		}
+		if cont != "" {
+			resp["continue"] = object{"gapcontinue": cont, "continue": "gapcontinue||"}
+		}
+	case p.Get("titles") != "":
+		for _, t := range splitMulti(p.Get("titles")) {
+			title := normalizeTitle(t)
+			if title != t {
+				normalized = append(normalized, object{"fromencoded": false, "from": t, "to": title})
+			}
+			if pg, ok := w.pages[title]; ok {
+				pages = append(pages, object{"pageid": pg.id, "ns": pg.ns, "title": pg.title})
+			} else {
+				ns, _ := splitNamespace(title)
+				pages = append(pages, object{"ns": ns, "title": title, "missing": true})
+			}
+		}
+	case p.Get("pageids") != "":
+		for _, idStr := range splitMulti(p.Get("pageids")) {
+			id, _ := strconv.Atoi(idStr)
+			if pg, ok := w.pagesByID[id]; ok {
+				pages = append(pages, object{"pageid": pg.id, "ns": pg.ns, "title": pg.title})
+			} else {
+				pages = append(pages, object{"pageid": id, "missing": true})
+			}
+		}
+	}
+
+	for _, prop := range splitMulti(p.Get("prop")) {
+		if prop != "revisions" {
+			return nil, &apiError{"badvalue", fmt.Sprintf(`Unrecognized value for parameter "prop": %s.`, prop)}
+		}
+		for _, pgObj := range pages {
+			if pgObj["missing"] == true {
+				continue
+			}
+			pg := w.pagesByID[pgObj["pageid"].(int)]
+			pgObj["revisions"] = []object{w.revision(pg.latest(), p)}
+		}
+	}
+
+	if normalized != nil {
+		query["normalized"] = normalized
+	}
+	if pages != nil {
+		query["pages"] = pages
+	}
+	if len(query) > 0 {
+		resp["query"] = query
+	}
+	return resp, nil
+}
+
+// allPages implements list=allpages (prefix "ap") and generator=allpages
+// (prefix "gap"). It returns the pages and the value of the continue
+// parameter, or "" if there are no more pages.
+func (w *Wiki) allPages(p url.Values, prefix string) ([]*page, string, *apiError) {
+	ns := 0
+	if v := p.Get(prefix + "namespace"); v != "" {
+		ns, _ = strconv.Atoi(v)
+	}
+	limit := 10
+	if v := p.Get(prefix + "limit"); v == "max" {
+		limit = 500
+	} else if v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			return nil, "", &apiError{"badinteger", fmt.Sprintf(`Invalid value "%s" for integer parameter "%slimit".`, v, prefix)}
+		}
+	}
+	from := p.Get(prefix + "from")
+	if c := p.Get(prefix + "continue"); c != "" {
+		from = c
+	}
+	from = strings.ReplaceAll(from, "_", " ")
+	prefixFilter := strings.ReplaceAll(p.Get(prefix+"prefix"), "_", " ")
+
+	var names []string
+	for _, pg := range w.pages {
+		_, name := splitNamespace(pg.title)
+		if pg.ns == ns && name >= from && strings.HasPrefix(name, prefixFilter) {
+			names = append(names, pg.title)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		_, a := splitNamespace(names[i])
+		_, b := splitNamespace(names[j])
+		return a < b
+	})
+
+	var cont string
+	if len(names) > limit {
+		_, cont = splitNamespace(names[limit])
+		cont = strings.ReplaceAll(cont, " ", "_")
+		names = names[:limit]
+	}
+	pages := make([]*page, len(names))
+	for i, name := range names {
+		pages[i] = w.pages[name]
+	}
+	return pages, cont, nil
+}
+
+// revision returns the representation of rev for prop=revisions
+// with the rvprop and rvslots parameters in p.
+func (w *Wiki) revision(rev Revision, p url.Values) object {
+	props := map[string]bool{}
+	rvprop := p.Get("rvprop")
+	if rvprop == "" {
+		rvprop = "ids|timestamp|flags|comment|user"
+	}
+	for _, prop := range splitMulti(rvprop) {
+		props[prop] = true
+	}
+
+	r := object{}
+	if props["ids"] {
+		r["revid"] = rev.ID
+		r["parentid"] = rev.ParentID
+	}
+	if props["flags"] {
+		r["minor"] = rev.Minor
+	}
+	if props["timestamp"] {
+		r["timestamp"] = rev.Timestamp.Format(timestampFormat)
+	}
+	if props["user"] {
+		r["user"] = rev.User
+	}
+	if props["userid"] {
+		r["userid"] = 0
+		if u, ok := w.users[rev.User]; ok {
+			r["userid"] = u.id
+		}
+	}
+	if props["comment"] {
+		r["comment"] = rev.Comment
+	}
+	if props["size"] {
+		r["size"] = len(rev.Content)
+	}
+	if props["sha1"] {
+		r["sha1"] = sha1Hex(rev.Content)
+	}
+
+	slot := object{}
+	if props["slotsize"] {
+		slot["size"] = len(rev.Content)
+	}
+	if props["slotsha1"] {
+		slot["sha1"] = sha1Hex(rev.Content)
+	}
+	if props["contentmodel"] || props["content"] {
+		slot["contentmodel"] = "wikitext"
+	}
+	if props["content"] {
+		slot["contentformat"] = "text/x-wiki"
+		slot["content"] = rev.Content
+	}
+	if len(slot) > 0 {
+		if p.Get("rvslots") != "" {
+			r["slots"] = object{"main": slot}
+		} else {
+			// Legacy format without slots.
+			for k, v := range slot {
+				if k != "size" && k != "sha1" {
+					r[k] = v
+				}
+			}
+		}
+	}
+	return r
+}
+
+// userInfo returns the response to meta=userinfo for u (nil for
+// anonymous users).
+func userInfo(u *user, props []string) object {
+	info := object{"id": 0, "name": anonUser, "anon": true}
+	rights := anonRights
+	if u != nil {
+		info = object{"id": u.id, "name": u.name}
+		rights = u.rights
+	}
+	for _, prop := range props {
+		if prop == "rights" {
+			info["rights"] = rights
+		}
+	}
+	return info
+}
+
+// splitMulti splits the value of a multi-value parameter.
+func splitMulti(v string) []string {
+	if v == "" {
+		return nil
+	}
+	if strings.HasPrefix(v, "\x1f") {
+		return strings.Split(v[1:], "\x1f")
+	}
+	return strings.Split(v, "|")
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func itoa(i int) string {
+	return strconv.Itoa(i)
+}
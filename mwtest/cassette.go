@@ -0,0 +1,258 @@
+package mwtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"cgt.name/pkg/go-mwclient/internal/redact"
+)
+
+// Mode is the mode of a Recorder.
+type Mode int
+
+// These consts are the modes of a Recorder.
+const (
+	// ModeReplay replays the interactions in a cassette file without making
+	// any real requests.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests to the real server and records the
+	// interactions, which are written to a cassette file by Recorder.Save.
+	ModeRecord
+)
+
+// Cassette contains the interactions recorded by a Recorder.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is an API request and the response to it.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a recorded API request. Params contains the parameters
+// of the request, from both the URL and the body, with secrets (passwords
+// and tokens) redacted.
+type RecordedRequest struct {
+	Method string            `json:"method"`
+	Params map[string]string `json:"params"`
+}
+
+// RecordedResponse is a recorded API response. Cookies and authorization
+// headers are redacted from Header and tokens are redacted from Body.
+type RecordedResponse struct {
+	StatusCode int         `json:"status"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+// Recorder is an http.RoundTripper that records API requests and
+// responses to a cassette file and replays them, so that tests can be run
+// against real-world responses without access to the wiki.
+//
+// Requests are matched with recorded interactions by their method and
+// parameters, regardless of the order of the parameters and whether they
+// were sent in the URL or in the body. The values of secret parameters are
+// not compared. If several recorded interactions match a request, the
+// first one that has not been replayed yet is used, so a sequence of
+// identical requests replays the recorded sequence of responses.
+//
+// Secrets are scrubbed from cassettes: passwords and tokens in requests,
+// tokens in responses and all cookies and authorization headers.
+//
+//	rec, err := mwtest.NewRecorder("testdata/edit.json", mwtest.ModeReplay, nil)
+//	...
+//	w.SetHTTPClient(rec.Client())
+type Recorder struct {
+	mode     Mode
+	path     string
+	real     http.RoundTripper
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// NewRecorder returns a new Recorder using the cassette file at path.
+// In ModeReplay, the cassette is read from path. In ModeRecord, requests are
+// sent with real (or http.DefaultTransport, if real is nil), and the
+// cassette is written to path by Save.
+func NewRecorder(path string, mode Mode, real http.RoundTripper) (*Recorder, error) {
+	if real == nil {
+		real = http.DefaultTransport
+	}
+	r := &Recorder{mode: mode, path: path, real: real}
+	if mode == ModeReplay {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &r.cassette); err != nil {
+			return nil, fmt.Errorf("mwtest: invalid cassette %s: %v", path, err)
+		}
+		r.used = make([]bool, len(r.cassette.Interactions))
+	}
+	return r, nil
+}
+
+// Client returns an *http.Client that uses the Recorder as its transport,
+// for use with mwclient.Client.SetHTTPClient.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Cassette returns a copy of the interactions recorded or loaded so far.
+func (r *Recorder) Cassette() Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Cassette{Interactions: append([]Interaction(nil), r.cassette.Interactions...)}
+}
+
+// Save writes the recorded interactions to the cassette file.
+// It must only be called in ModeRecord.
+func (r *Recorder) Save() error {
+	if r.mode != ModeRecord {
+		return errors.New("mwtest: Save called on a Recorder that is not recording")
+	}
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, append(data, '\n'), 0o644)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	params, body, err := requestParams(req)
+	if err != nil {
+		return nil, fmt.Errorf("mwtest: unable to read request parameters: %v", err)
+	}
+	rec := RecordedRequest{Method: req.Method, Params: redact.Params(params)}
+
+	if r.mode == ModeReplay {
+		return r.replay(req, rec)
+	}
+
+	if body != nil {
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	resp, err := r.real.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request: rec,
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     redact.Header(resp.Header),
+			Body:       string(redact.Body(respBody)),
+		},
+	})
+	r.mu.Unlock()
+
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	return resp, nil
+}
+
+// replay returns the response of the first unused interaction matching rec.
+func (r *Recorder) replay(req *http.Request, rec RecordedRequest) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, in := range r.cassette.Interactions {
+		if r.used[i] || !matches(in.Request, rec) {
+			continue
+		}
+		r.used[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+			StatusCode:    in.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Header.Clone(),
+			Body:          io.NopCloser(strings.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("mwtest: no unused interaction in cassette %s matches %s request with parameters %s",
+		r.path, rec.Method, formatParams(rec.Params))
+}
+
+func matches(a, b RecordedRequest) bool {
+	if a.Method != b.Method || len(a.Params) != len(b.Params) {
+		return false
+	}
+	for k, v := range a.Params {
+		if bv, ok := b.Params[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// formatParams formats params deterministically for error messages.
+func formatParams(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(url.QueryEscape(k) + "=" + url.QueryEscape(params[k]))
+	}
+	return b.String()
+}
+
+// requestParams returns the parameters of req from its URL and body.
+// If req has a body, it is returned so that the request can be sent again.
+func requestParams(req *http.Request) (map[string]string, []byte, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	parsed := &http.Request{
+		Method: req.Method,
+		URL:    req.URL,
+		Header: req.Header,
+		Body:   io.NopCloser(bytes.NewReader(body)),
+	}
+	if err := parsed.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+		return nil, nil, err
+	}
+
+	params := make(map[string]string, len(parsed.Form))
+	for k, v := range parsed.Form {
+		params[k] = strings.Join(v, "|")
+	}
+	return params, body, nil
+}
@@ -0,0 +1,83 @@
+package mwtest_test
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cgt.name/pkg/go-mwclient"
+	"cgt.name/pkg/go-mwclient/mwtest"
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// session logs in, edits a page twice and reads it.
+func session(t *testing.T, w *mwclient.Client) string {
+	t.Helper()
+	if err := w.Login("ExampleBot", "hunter2"); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	for _, text := range []string{"first", strings.Repeat("second ", 2000)} {
+		if err := w.Edit(params.Values{"title": "Sandbox", "text": text}); err != nil {
+			t.Fatalf("edit failed: %v", err)
+		}
+	}
+	content, _, err := w.GetPageByName("Sandbox")
+	if err != nil {
+		t.Fatalf("GetPageByName failed: %v", err)
+	}
+	return content
+}
+
+func TestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	wiki := mwtest.NewWiki()
+	wiki.AddUser("ExampleBot", "hunter2")
+	server := httptest.NewServer(wiki)
+	w, err := mwclient.New(server.URL, "mwtest test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := mwtest.NewRecorder(path, mwtest.ModeRecord, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.SetHTTPClient(rec.Client())
+	recorded := session(t, w)
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"hunter2", "mwtest_session", `+\\"`} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains secret %q", secret)
+		}
+	}
+
+	// Replay with a new client while the server is down.
+	w, err = mwclient.New(server.URL, "mwtest test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep, err := mwtest.NewRecorder(path, mwtest.ModeReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.SetHTTPClient(rep.Client())
+	if replayed := session(t, w); replayed != recorded {
+		t.Errorf("replayed content %q, recorded %q", replayed, recorded)
+	}
+
+	// All interactions have been used up.
+	if _, err := w.Get(params.Values{"action": "query", "meta": "userinfo"}); err == nil ||
+		!strings.Contains(err.Error(), "no unused interaction") {
+		t.Errorf("expected unmatched request error, got %v", err)
+	}
+}
@@ -0,0 +1,338 @@
+// Package mwtest provides an in-memory fake MediaWiki wiki for testing
+// programs that use go-mwclient without a live wiki.
+//
+// A Wiki implements http.Handler and serves a subset of the MediaWiki
+// Action API (with formatversion=2) at any path:
+//
+//	wiki := mwtest.NewWiki()
+//	wiki.AddUser("ExampleBot", "password", "bot")
+//	wiki.SetPage("Main Page", "Hello, world!")
+//	server := httptest.NewServer(wiki)
+//	defer server.Close()
+//
+//	w, err := mwclient.New(server.URL, "test")
+//
+// The following API modules are supported:
+//
+//   - action=query with meta=tokens, meta=userinfo, prop=revisions (latest
+//     revision only), list=allpages and generator=allpages, including
+//     continuation
+//   - action=login, action=clientlogin (username and password only) and
+//     action=logout
+//   - action=edit with text, appendtext or prependtext, edit conflict
+//     detection (baserevid and basetimestamp), createonly, nocreate, minor
+//     and CAPTCHAs (see Wiki.RequireCaptcha)
+//
+// The maxlag and assert parameters are honored. Errors can be injected with
+// Wiki.FailNext and Wiki.FailNextStatus, and replication lag can be
+// simulated with Wiki.SetLag.
+//
+// A Recorder records the API requests made to a real wiki and their
+// responses in a cassette file, and replays them in tests.
+package mwtest
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Revision is a revision of a page on a Wiki.
+type Revision struct {
+	ID        int
+	ParentID  int
+	Timestamp time.Time
+	User      string
+	Comment   string
+	Minor     bool
+	Content   string
+}
+
+// page is a page on a Wiki.
+type page struct {
+	id        int
+	ns        int
+	title     string
+	revisions []Revision
+}
+
+// latest returns the current revision of p.
+func (p *page) latest() Revision {
+	return p.revisions[len(p.revisions)-1]
+}
+
+// user is a registered user on a Wiki.
+type user struct {
+	id       int
+	name     string
+	password string
+	rights   []string
+}
+
+func (u *user) hasRight(right string) bool {
+	for _, r := range u.rights {
+		if r == right {
+			return true
+		}
+	}
+	return false
+}
+
+// session is a session identified by a cookie.
+type session struct {
+	user       *user
+	loginToken string
+	csrfToken  string
+}
+
+// failure is an error queued with FailNext or FailNextStatus.
+type failure struct {
+	action string
+	status int
+	code   string
+	info   string
+}
+
+// captcha is the CAPTCHA configured with RequireCaptcha.
+type captcha struct {
+	id       string
+	question string
+	answer   string
+}
+
+// Wiki is an in-memory fake MediaWiki wiki. It is safe for concurrent use.
+// Use NewWiki to create a Wiki.
+type Wiki struct {
+	// Now returns the current time, which is used for revision timestamps.
+	// It may be replaced before the Wiki is used.
+	Now func() time.Time
+
+	mu        sync.Mutex
+	pages     map[string]*page // keyed by title
+	pagesByID map[int]*page
+	users     map[string]*user // keyed by name
+	sessions  map[string]*session
+	lastID    int // last ID assigned to a page, revision, user or session
+	lag       int
+	captcha   *captcha
+	failures  []failure
+}
+
+// defaultRights are the rights every logged-in user has.
+var defaultRights = []string{"read", "edit", "createpage", "writeapi", "minoredit"}
+
+// anonRights are the rights of anonymous users.
+var anonRights = []string{"read", "edit", "createpage", "writeapi"}
+
+// NewWiki returns a new empty Wiki.
+func NewWiki() *Wiki {
+	return &Wiki{
+		Now:       func() time.Time { return time.Now().UTC() },
+		pages:     map[string]*page{},
+		pagesByID: map[int]*page{},
+		users:     map[string]*user{},
+		sessions:  map[string]*session{},
+	}
+}
+
+// nextID returns a new unique ID.
+func (w *Wiki) nextID() int {
+	w.lastID++
+	return w.lastID
+}
+
+// AddUser registers a user with the given name and password.
+// The user has the rights of all logged-in users (read, edit, createpage,
+// writeapi and minoredit) and the additional rights given, such as "bot"
+// (required for assert=bot) or "apihighlimits".
+func (w *Wiki) AddUser(name, password string, rights ...string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	name = normalizeTitle(name)
+	w.users[name] = &user{
+		id:       w.nextID(),
+		name:     name,
+		password: password,
+		rights:   append(append([]string(nil), defaultRights...), rights...),
+	}
+}
+
+// SetPage saves content as a new revision of the page with the given title,
+// creating the page if it does not exist, and returns the ID of the new
+// revision. The revision is attributed to the user "MediaWiki default".
+func (w *Wiki) SetPage(title, content string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.saveRevision(normalizeTitle(title), content, "MediaWiki default", "", false).ID
+}
+
+// Page returns the current revision of the page with the given title.
+// ok is false if the page does not exist.
+func (w *Wiki) Page(title string) (rev Revision, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	p, ok := w.pages[normalizeTitle(title)]
+	if !ok {
+		return Revision{}, false
+	}
+	return p.latest(), true
+}
+
+// Revisions returns all revisions of the page with the given title,
+// oldest first, or nil if the page does not exist.
+func (w *Wiki) Revisions(title string) []Revision {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	p, ok := w.pages[normalizeTitle(title)]
+	if !ok {
+		return nil
+	}
+	return append([]Revision(nil), p.revisions...)
+}
+
+// DeletePage deletes the page with the given title and all its revisions.
+func (w *Wiki) DeletePage(title string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if p, ok := w.pages[normalizeTitle(title)]; ok {
+		delete(w.pages, p.title)
+		delete(w.pagesByID, p.id)
+	}
+}
+
+// SetLag sets the simulated database replication lag in seconds.
+// Requests whose maxlag parameter is less than the lag fail with a maxlag
+// error, and the Retry-After header of the response is set to the lag.
+// The default lag is 0.
+func (w *Wiki) SetLag(seconds int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lag = seconds
+}
+
+// RequireCaptcha makes all edits fail with a CAPTCHA (of the type "simple")
+// asking question, unless the captchaid and captchaword parameters of the
+// edit contain the ID of the CAPTCHA and answer.
+// To disable CAPTCHAs again, call RequireCaptcha with an empty question.
+func (w *Wiki) RequireCaptcha(question, answer string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if question == "" {
+		w.captcha = nil
+		return
+	}
+	w.captcha = &captcha{
+		id:       itoa(w.nextID()),
+		question: question,
+		answer:   answer,
+	}
+}
+
+// FailNext makes the next request with the given action (e.g. "edit") fail
+// with an API error with the given code and info. If action is empty,
+// the next request fails regardless of its action.
+// Calls to FailNext and FailNextStatus are queued, so several requests can
+// be made to fail.
+func (w *Wiki) FailNext(action, code, info string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.failures = append(w.failures, failure{action: action, code: code, info: info})
+}
+
+// FailNextStatus is like FailNext, but the request fails with the given
+// HTTP status code (e.g. http.StatusServiceUnavailable) and an empty body.
+func (w *Wiki) FailNextStatus(action string, status int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.failures = append(w.failures, failure{action: action, status: status})
+}
+
+// takeFailure removes and returns the first queued failure for action.
+func (w *Wiki) takeFailure(action string) (failure, bool) {
+	for i, f := range w.failures {
+		if f.action == "" || f.action == action {
+			w.failures = append(w.failures[:i], w.failures[i+1:]...)
+			return f, true
+		}
+	}
+	return failure{}, false
+}
+
+// saveRevision saves a new revision of the page with the normalized title,
+// creating the page if necessary.
+func (w *Wiki) saveRevision(title, content, user, comment string, minor bool) Revision {
+	p, ok := w.pages[title]
+	if !ok {
+		ns, _ := splitNamespace(title)
+		p = &page{id: w.nextID(), ns: ns, title: title}
+		w.pages[title] = p
+		w.pagesByID[p.id] = p
+	}
+	rev := Revision{
+		ID:        w.nextID(),
+		Timestamp: w.Now().UTC().Truncate(time.Second),
+		User:      user,
+		Comment:   comment,
+		Minor:     minor,
+		Content:   content,
+	}
+	if len(p.revisions) > 0 {
+		rev.ParentID = p.latest().ID
+	}
+	p.revisions = append(p.revisions, rev)
+	return rev
+}
+
+// namespaces maps the names of the namespaces known to a Wiki to their IDs.
+var namespaces = map[string]int{
+	"Talk":           1,
+	"User":           2,
+	"User talk":      3,
+	"Project":        4,
+	"Project talk":   5,
+	"File":           6,
+	"File talk":      7,
+	"MediaWiki":      8,
+	"MediaWiki talk": 9,
+	"Template":       10,
+	"Template talk":  11,
+	"Help":           12,
+	"Help talk":      13,
+	"Category":       14,
+	"Category talk":  15,
+}
+
+// splitNamespace returns the namespace ID of the normalized title and
+// the title without the namespace prefix.
+func splitNamespace(title string) (ns int, rest string) {
+	if i := strings.Index(title, ":"); i > 0 {
+		if ns, ok := namespaces[title[:i]]; ok {
+			return ns, title[i+1:]
+		}
+	}
+	return 0, title
+}
+
+// normalizeTitle normalizes a page title the way MediaWiki does with its
+// default configuration: underscores become spaces, surrounding whitespace
+// is removed and the first letters of the namespace and the title are
+// capitalized.
+func normalizeTitle(title string) string {
+	title = strings.TrimSpace(strings.ReplaceAll(title, "_", " "))
+	if i := strings.Index(title, ":"); i > 0 {
+		prefix := ucfirst(strings.TrimSpace(title[:i]))
+		if _, ok := namespaces[prefix]; ok {
+			return prefix + ":" + ucfirst(strings.TrimSpace(title[i+1:]))
+		}
+	}
+	return ucfirst(title)
+}
+
+func ucfirst(s string) string {
+	for i, r := range s {
+		if i == 0 {
+			return strings.ToUpper(string(r)) + s[len(string(r)):]
+		}
+	}
+	return s
+}
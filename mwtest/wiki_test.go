@@ -0,0 +1,234 @@
+package mwtest_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cgt.name/pkg/go-mwclient"
+	"cgt.name/pkg/go-mwclient/mwtest"
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+func setup(t *testing.T) (*mwtest.Wiki, *mwclient.Client) {
+	t.Helper()
+	wiki := mwtest.NewWiki()
+	server := httptest.NewServer(wiki)
+	t.Cleanup(server.Close)
+	w, err := mwclient.New(server.URL, "mwtest test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wiki, w
+}
+
+func TestLoginAndEdit(t *testing.T) {
+	wiki, w := setup(t)
+	wiki.AddUser("ExampleBot", "secret", "bot")
+	wiki.SetPage("Sandbox", "old text")
+
+	if err := w.Login("ExampleBot", "wrong"); err == nil {
+		t.Fatal("login with wrong password succeeded")
+	}
+	if err := w.Login("ExampleBot", "secret"); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	w.Assert = mwclient.AssertBot
+
+	err := w.EditPage("sandbox", func(old string) (string, string, error) {
+		return old + " and new text", "test edit", nil
+	})
+	if err != nil {
+		t.Fatalf("EditPage failed: %v", err)
+	}
+
+	rev, ok := wiki.Page("Sandbox")
+	if !ok || rev.Content != "old text and new text" || rev.User != "ExampleBot" || rev.Comment != "test edit" {
+		t.Errorf("unexpected revision: %+v", rev)
+	}
+	if n := len(wiki.Revisions("Sandbox")); n != 2 {
+		t.Errorf("got %d revisions, want 2", n)
+	}
+
+	pages, err := w.GetPages("Sandbox", "Missing page")
+	if err != nil {
+		t.Fatalf("GetPages failed: %v", err)
+	}
+	if p := pages["Sandbox"]; p.Content() != rev.Content || p.RevID != rev.ID || p.User != "ExampleBot" {
+		t.Errorf("unexpected page: %+v", p)
+	}
+	if p := pages["Missing page"]; p.Error != mwclient.ErrPageNotFound {
+		t.Errorf("expected ErrPageNotFound, got %v", p.Error)
+	}
+
+	result, err := w.EditWithResult(params.Values{"title": "Sandbox", "text": rev.Content})
+	if err != nil || !result.NoChange {
+		t.Errorf("expected no-change edit, got %+v, %v", result, err)
+	}
+}
+
+func TestEditConflict(t *testing.T) {
+	wiki, w := setup(t)
+	wiki.SetPage("Sandbox", "a")
+
+	calls := 0
+	err := w.EditPage("Sandbox", func(old string) (string, string, error) {
+		calls++
+		if calls == 1 {
+			// Someone else edits the page in the meantime.
+			wiki.SetPage("Sandbox", "b")
+		}
+		return old + "c", "", nil
+	})
+	if err != nil {
+		t.Fatalf("EditPage failed: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("EditFunc called %d times, want 2", calls)
+	}
+	if rev, _ := wiki.Page("Sandbox"); rev.Content != "bc" {
+		t.Errorf("content = %q, want %q", rev.Content, "bc")
+	}
+}
+
+func TestQueryContinuation(t *testing.T) {
+	wiki, w := setup(t)
+	for _, title := range []string{"A", "B", "C", "D", "E"} {
+		wiki.SetPage(title, "content of "+title)
+	}
+	wiki.SetPage("Talk:A", "not in main namespace")
+
+	q := w.NewQuery(params.Values{"list": "allpages", "aplimit": "2"})
+	var titles []string
+	for q.Next() {
+		pages, err := q.Resp().GetObjectArray("query", "allpages")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range pages {
+			title, _ := p.GetString("title")
+			titles = append(titles, title)
+		}
+	}
+	if q.Err() != nil {
+		t.Fatalf("query failed: %v", q.Err())
+	}
+	if len(titles) != 5 || titles[0] != "A" || titles[4] != "E" {
+		t.Errorf("titles = %v", titles)
+	}
+}
+
+func TestMaxlag(t *testing.T) {
+	wiki, w := setup(t)
+	wiki.SetLag(10)
+	w.Maxlag.On = true
+	w.Maxlag.Retries = 1
+
+	if _, err := w.Get(params.Values{"action": "query", "meta": "userinfo"}); err != mwclient.ErrAPIBusy {
+		t.Errorf("expected ErrAPIBusy, got %v", err)
+	}
+	wiki.SetLag(0)
+	if _, err := w.Get(params.Values{"action": "query", "meta": "userinfo"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCaptcha(t *testing.T) {
+	wiki, w := setup(t)
+	wiki.RequireCaptcha("What is 2+2?", "4")
+
+	err := w.Edit(params.Values{"title": "Sandbox", "text": "spam"})
+	var captcha mwclient.CaptchaError
+	if !errors.As(err, &captcha) || captcha.Question != "What is 2+2?" {
+		t.Fatalf("expected CaptchaError, got %v", err)
+	}
+
+	err = w.Edit(params.Values{
+		"title":       "Sandbox",
+		"text":        "not spam",
+		"captchaid":   captcha.ID,
+		"captchaword": "4",
+	})
+	if err != nil {
+		t.Fatalf("edit with solved CAPTCHA failed: %v", err)
+	}
+	if rev, _ := wiki.Page("Sandbox"); rev.User != "127.0.0.1" {
+		t.Errorf("anonymous edit attributed to %q", rev.User)
+	}
+}
+
+func TestFailNext(t *testing.T) {
+	wiki, w := setup(t)
+	wiki.FailNext("edit", "readonly", "The wiki is currently in read-only mode.")
+	wiki.FailNextStatus("", http.StatusServiceUnavailable)
+
+	if _, err := w.Get(params.Values{"action": "query", "meta": "userinfo"}); err == nil {
+		t.Error("expected HTTP error")
+	}
+	err := w.Edit(params.Values{"title": "Sandbox", "text": "x"})
+	if apierr, ok := err.(mwclient.APIError); !ok || apierr.Code != "readonly" {
+		t.Errorf("expected readonly error, got %v", err)
+	}
+	if err := w.Edit(params.Values{"title": "Sandbox", "text": "x"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestAssert(t *testing.T) {
+	wiki, w := setup(t)
+	wiki.AddUser("Human", "secret")
+	w.Assert = mwclient.AssertUser
+
+	_, err := w.Get(params.Values{"action": "query", "meta": "userinfo"})
+	if apierr, ok := err.(mwclient.APIError); !ok || apierr.Code != "assertuserfailed" {
+		t.Errorf("expected assertuserfailed, got %v", err)
+	}
+
+	w.Assert = mwclient.AssertNone
+	if err := w.ClientLogin("Human", "secret", nil); err != nil {
+		t.Fatalf("ClientLogin failed: %v", err)
+	}
+	w.Assert = mwclient.AssertBot
+	_, err = w.Get(params.Values{"action": "query", "meta": "userinfo"})
+	if apierr, ok := err.(mwclient.APIError); !ok || apierr.Code != "assertbotfailed" {
+		t.Errorf("expected assertbotfailed, got %v", err)
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	wiki, w := setup(t)
+	for _, title := range []string{"A", "B", "C"} {
+		wiki.SetPage(title, "content of "+title)
+	}
+
+	type batch struct {
+		Query struct {
+			Pages []struct {
+				Title     string
+				Revisions []struct {
+					Slots map[string]struct{ Content string }
+				}
+			}
+		}
+	}
+	q := mwclient.NewTypedQuery[batch](w, params.Values{
+		"generator": "allpages",
+		"gaplimit":  "2",
+		"prop":      "revisions",
+		"rvprop":    "content",
+		"rvslots":   "main",
+	})
+	contents := map[string]string{}
+	for b, err := range q.All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range b.Query.Pages {
+			contents[p.Title] = p.Revisions[0].Slots["main"].Content
+		}
+	}
+	if len(contents) != 3 || contents["C"] != "content of C" {
+		t.Errorf("contents = %v", contents)
+	}
+}
@@ -0,0 +1,127 @@
+package mwclient
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OAuth2Endpoint returns the authorization and token URLs of the OAuth 2.0
+// endpoint of a wiki running the OAuth extension, given the URL of the
+// wiki's rest.php (e.g. "https://meta.wikimedia.org/w/rest.php").
+// They can be used to obtain tokens through the authorization code grant
+// or the client credentials grant, e.g. with golang.org/x/oauth2 (where
+// the endpoint's AuthStyle must be oauth2.AuthStyleInParams).
+// See https://www.mediawiki.org/wiki/OAuth/For_Developers#OAuth_2
+func OAuth2Endpoint(restURL string) (authURL, tokenURL string) {
+	restURL = strings.TrimSuffix(restURL, "/")
+	return restURL + "/oauth2/authorize", restURL + "/oauth2/access_token"
+}
+
+// OAuth2TokenFunc returns an OAuth 2.0 access token and the time at which
+// it expires. A zero expiry means that the token does not expire.
+type OAuth2TokenFunc func(ctx context.Context) (token string, expiry time.Time, err error)
+
+// oauth2ExpiryDelta is how long before their expiry OAuth 2.0 access
+// tokens are renewed, so that they do not expire in transit.
+const oauth2ExpiryDelta = 10 * time.Second
+
+// OAuth2 configures OAuth 2.0 authentication. After calling OAuth2, future
+// requests will carry a bearer token obtained from token. Like OAuth,
+// OAuth2 does not make any API calls, so authentication failures will
+// appear in response to the first API call after OAuth2 has been
+// configured. Do not mix use of OAuth2 with Login/Logout or OAuth.
+//
+// OAuth2 does not obtain or refresh tokens itself: token must do that,
+// e.g. with the refresh_token grant against the token URL returned by
+// OAuth2Endpoint, and persist any new refresh token. token is called before
+// the first request, whenever the previous token has expired or is about
+// to expire, and after a request has been rejected with HTTP 401
+// Unauthorized (the rejected request itself is not retried). Calls to token
+// are serialized, and errors it returns are returned by the request that
+// needed the token. For owner-only consumers, return the access token
+// issued for the consumer with a zero expiry.
+//
+// For example, with a TokenSource ts from golang.org/x/oauth2 (which is
+// not a dependency of go-mwclient):
+//
+//	w.OAuth2(func(ctx context.Context) (string, time.Time, error) {
+//		tok, err := ts.Token()
+//		if err != nil {
+//			return "", time.Time{}, err
+//		}
+//		return tok.AccessToken, tok.Expiry, nil
+//	})
+//
+// Alternatively, an oauth2.Transport can be installed with WrapTransport.
+//
+// OAuth2 keeps the Client's cookie jar, timeout and base transport.
+func (w *Client) OAuth2(token OAuth2TokenFunc) {
+	w.WrapTransport(func(base http.RoundTripper) http.RoundTripper {
+		return &oauth2Transport{token: token, base: base}
+	})
+	w.resetLimits()
+}
+
+// oauth2Transport is an http.RoundTripper that adds a bearer token
+// obtained from token to requests and sends them with base.
+type oauth2Transport struct {
+	token OAuth2TokenFunc
+	base  http.RoundTripper
+
+	mu     sync.Mutex
+	cached string
+	expiry time.Time
+}
+
+// accessToken returns the cached token, or a new token if the cached token
+// has expired.
+func (t *oauth2Transport) accessToken(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.cached != "" && (t.expiry.IsZero() || time.Until(t.expiry) > oauth2ExpiryDelta) {
+		return t.cached, nil
+	}
+	tok, expiry, err := t.token(ctx)
+	if err != nil {
+		return "", err
+	}
+	t.cached, t.expiry = tok, expiry
+	return tok, nil
+}
+
+func (t *oauth2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tok, err := t.accessToken(req.Context())
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+tok)
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		t.invalidate(tok)
+	}
+	return resp, err
+}
+
+// invalidate discards the cached token if it is tok, so that the next
+// request obtains a new token.
+func (t *oauth2Transport) invalidate(tok string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.cached == tok {
+		t.cached = ""
+	}
+}
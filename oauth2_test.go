@@ -0,0 +1,150 @@
+package mwclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+func TestOAuth2Endpoint(t *testing.T) {
+	authURL, tokenURL := OAuth2Endpoint("https://meta.wikimedia.org/w/rest.php/")
+	if authURL != "https://meta.wikimedia.org/w/rest.php/oauth2/authorize" {
+		t.Errorf("unexpected authorization URL: %s", authURL)
+	}
+	if tokenURL != "https://meta.wikimedia.org/w/rest.php/oauth2/access_token" {
+		t.Errorf("unexpected token URL: %s", tokenURL)
+	}
+}
+
+func TestOAuth2RefreshesToken(t *testing.T) {
+	var mu sync.Mutex
+	var tokens []string
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		want := tokens[len(tokens)-1]
+		mu.Unlock()
+		if v := r.Header.Get("Authorization"); v != "Bearer "+want {
+			t.Errorf("unexpected Authorization header: %s", v)
+		}
+		fmt.Fprint(w, `{"batchcomplete":true}`)
+	})
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	client.LoadCookies([]*http.Cookie{{Name: "session", Value: "abc"}})
+
+	// The first token is about to expire, so it is only used once.
+	expiries := []time.Time{time.Now().Add(time.Second), time.Now().Add(time.Hour)}
+	client.OAuth2(func(ctx context.Context) (string, time.Time, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		tok := fmt.Sprintf("ACCESS%d", len(tokens)+1)
+		expiry := expiries[len(tokens)]
+		tokens = append(tokens, tok)
+		return tok, expiry, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.Get(params.Values{"action": "query"}); err != nil {
+			t.Fatalf("Get() returned err: %v", err)
+		}
+	}
+
+	if fmt.Sprint(tokens) != "[ACCESS1 ACCESS2]" {
+		t.Errorf("unexpected tokens obtained: %v", tokens)
+	}
+	if len(client.httpc.Jar.Cookies(u)) != 1 {
+		t.Error("cookie jar was not preserved")
+	}
+}
+
+func TestOAuth2RenewsTokenAfterUnauthorized(t *testing.T) {
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer REVOKED" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":true}`)
+	})
+	defer server.Close()
+
+	var tokens []string
+	client.OAuth2(func(ctx context.Context) (string, time.Time, error) {
+		tok := "REVOKED"
+		if len(tokens) > 0 {
+			tok = "ACCESS"
+		}
+		tokens = append(tokens, tok)
+		return tok, time.Now().Add(time.Hour), nil
+	})
+
+	_, err := client.Get(params.Values{"action": "query"})
+	var httpErr HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected HTTPError 401, got %v", err)
+	}
+	if _, err := client.Get(params.Values{"action": "query"}); err != nil {
+		t.Fatalf("Get() returned err: %v", err)
+	}
+	if fmt.Sprint(tokens) != "[REVOKED ACCESS]" {
+		t.Errorf("unexpected tokens obtained: %v", tokens)
+	}
+}
+
+func TestOAuth2TokenError(t *testing.T) {
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request sent without a token")
+	})
+	defer server.Close()
+
+	client.OAuth2(func(ctx context.Context) (string, time.Time, error) {
+		return "", time.Time{}, errors.New("refresh failed")
+	})
+
+	_, err := client.Get(params.Values{"action": "query"})
+	if err == nil || !strings.Contains(err.Error(), "refresh failed") {
+		t.Errorf("expected token error, got %v", err)
+	}
+}
+
+type headerTransport struct {
+	base http.RoundTripper
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Test", "wrapped")
+	return t.base.RoundTrip(req)
+}
+
+func TestWrapTransport(t *testing.T) {
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		if v := r.Header.Get("X-Test"); v != "wrapped" {
+			t.Errorf("request not sent through wrapped transport: X-Test=%q", v)
+		}
+		fmt.Fprint(w, `{"batchcomplete":true}`)
+	})
+	defer server.Close()
+
+	client.SetHTTPTimeout(5 * time.Second)
+	client.WrapTransport(func(base http.RoundTripper) http.RoundTripper {
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		return headerTransport{base}
+	})
+	if client.httpc.Timeout != 5*time.Second {
+		t.Errorf("timeout not preserved: %v", client.httpc.Timeout)
+	}
+	if _, err := client.Get(params.Values{"action": "query"}); err != nil {
+		t.Fatalf("Get() returned err: %v", err)
+	}
+}
@@ -0,0 +1,334 @@
+package mwclient
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mrjones/oauth"
+)
+
+// OAuthFlow drives the three-legged OAuth 1.0a handshake used to obtain
+// access tokens for an OAuth consumer that is not owner-only.
+// See https://www.mediawiki.org/wiki/OAuth/For_Developers
+//
+// An OAuthFlow should be instantiated through the NewOAuthFlow method on
+// the Client type. The handshake then consists of three steps:
+//
+//	f, err := w.NewOAuthFlow("https://en.wikipedia.org/w/index.php",
+//		consumerToken, consumerSecret)
+//	// 1. Obtain a request token and the URL the user must visit.
+//	authURL, err := f.Initiate()
+//	// 2. The user visits authURL, authorizes the consumer and is given
+//	//    a verification code (or redirected to the consumer's callback
+//	//    URL with the code in the oauth_verifier parameter).
+//	// 3. Exchange the verification code for an access token.
+//	//    Complete configures w to use the access token.
+//	token, err := f.Complete(verifier)
+//
+// The access token returned by Complete may be stored and used later with
+// Client.OAuth. Identify can be used to securely obtain information about
+// the user who authorized the consumer.
+type OAuthFlow struct {
+	w *Client
+	// httpc is the HTTP client used for the handshake. It is the Client's
+	// HTTP client at the time the OAuthFlow was created, as Complete
+	// replaces the Client's HTTP client with one that signs every request.
+	httpc          *http.Client
+	indexURL       *url.URL
+	consumerToken  string
+	consumerSecret string
+	// Callback is the URL the user will be redirected to after authorizing
+	// the consumer. It must match the callback URL the consumer was
+	// registered with. Defaults to "oob" (out-of-band), in which case
+	// the user is shown the verification code instead.
+	Callback string
+
+	requestToken  OAuthToken
+	accessToken   OAuthToken
+	authenticated bool
+}
+
+// OAuthToken is an OAuth 1.0a token and its secret.
+type OAuthToken struct {
+	Token  string
+	Secret string
+}
+
+// OAuthIdentity contains information about a user who has authorized an
+// OAuth consumer, as returned by OAuthFlow.Identify.
+// See https://www.mediawiki.org/wiki/Extension:OAuth#Identify_the_user
+type OAuthIdentity struct {
+	Issuer         string   `json:"iss"`
+	Subject        string   `json:"sub"`
+	Audience       string   `json:"aud"`
+	ExpiresAt      int64    `json:"exp"`
+	IssuedAt       int64    `json:"iat"`
+	Nonce          string   `json:"nonce"`
+	Username       string   `json:"username"`
+	EditCount      int      `json:"editcount"`
+	ConfirmedEmail bool     `json:"confirmed_email"`
+	Blocked        bool     `json:"blocked"`
+	Registered     string   `json:"registered"`
+	Groups         []string `json:"groups"`
+	Rights         []string `json:"rights"`
+	Grants         []string `json:"grants"`
+}
+
+// ErrOAuthNotAuthorized is returned by OAuthFlow methods that require
+// a request or access token if the corresponding step of the handshake has
+// not been completed.
+var ErrOAuthNotAuthorized = errors.New("OAuth handshake not completed")
+
+// NewOAuthFlow instantiates a new OAuthFlow for the consumer with the given
+// token and secret. indexURL is the URL of the wiki's index.php
+// (e.g. "https://en.wikipedia.org/w/index.php"), which hosts Special:OAuth.
+// If the provided URL is invalid (as defined by the net/url package),
+// NewOAuthFlow returns the error from url.Parse().
+func (w *Client) NewOAuthFlow(indexURL, consumerToken, consumerSecret string) (*OAuthFlow, error) {
+	u, err := url.Parse(indexURL)
+	if err != nil {
+		return nil, err
+	}
+	return &OAuthFlow{
+		w:              w,
+		httpc:          w.httpc,
+		indexURL:       u,
+		consumerToken:  consumerToken,
+		consumerSecret: consumerSecret,
+		Callback:       "oob",
+	}, nil
+}
+
+// Initiate obtains a request token from Special:OAuth/initiate and returns
+// the URL of Special:OAuth/authorize that the user must visit to authorize
+// the consumer.
+func (f *OAuthFlow) Initiate() (authorizeURL string, err error) {
+	return f.InitiateContext(context.Background())
+}
+
+// InitiateContext is like Initiate, but the request is bound to ctx.
+func (f *OAuthFlow) InitiateContext(ctx context.Context) (authorizeURL string, err error) {
+	resp, err := f.tokenRequest(ctx, "Special:OAuth/initiate", OAuthToken{},
+		map[string]string{"oauth_callback": f.Callback})
+	if err != nil {
+		return "", err
+	}
+	f.requestToken = resp
+
+	q := url.Values{}
+	q.Set("title", "Special:OAuth/authorize")
+	q.Set("oauth_token", f.requestToken.Token)
+	q.Set("oauth_consumer_key", f.consumerToken)
+	u := *f.indexURL
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Complete exchanges the verification code obtained by the user when
+// authorizing the consumer for an access token at Special:OAuth/token,
+// and configures the Client to use it (see Client.OAuth).
+// The returned access token may be stored for later use with Client.OAuth.
+func (f *OAuthFlow) Complete(verifier string) (OAuthToken, error) {
+	return f.CompleteContext(context.Background(), verifier)
+}
+
+// CompleteContext is like Complete, but the request is bound to ctx.
+func (f *OAuthFlow) CompleteContext(ctx context.Context, verifier string) (OAuthToken, error) {
+	if f.requestToken.Token == "" {
+		return OAuthToken{}, ErrOAuthNotAuthorized
+	}
+
+	token, err := f.tokenRequest(ctx, "Special:OAuth/token", f.requestToken,
+		map[string]string{"oauth_verifier": verifier})
+	if err != nil {
+		return OAuthToken{}, err
+	}
+
+	err = f.w.OAuth(f.consumerToken, f.consumerSecret, token.Token, token.Secret)
+	if err != nil {
+		return OAuthToken{}, err
+	}
+	f.accessToken = token
+	f.authenticated = true
+	return token, nil
+}
+
+// Identify retrieves information about the user who authorized the consumer
+// from Special:OAuth/identify and verifies the signature and claims of the
+// returned JSON Web Token: it must be signed with the consumer secret, be
+// issued by the wiki for this consumer, be currently valid, and contain
+// the nonce sent with the request.
+// Identify may only be called after Complete.
+func (f *OAuthFlow) Identify() (*OAuthIdentity, error) {
+	return f.IdentifyContext(context.Background())
+}
+
+// IdentifyContext is like Identify, but the request is bound to ctx.
+func (f *OAuthFlow) IdentifyContext(ctx context.Context) (*OAuthIdentity, error) {
+	if !f.authenticated {
+		return nil, ErrOAuthNotAuthorized
+	}
+
+	body, nonce, err := f.signedRequest(ctx, "Special:OAuth/identify", f.accessToken, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return verifyIdentity(string(body), f.consumerToken, f.consumerSecret,
+		f.indexURL.Scheme+"://"+f.indexURL.Host, nonce, time.Now())
+}
+
+// identityLeeway is the allowed clock skew when checking the iat and exp
+// claims of an identity JWT.
+const identityLeeway = 5 * time.Minute
+
+// verifyIdentity verifies the JWT returned by Special:OAuth/identify and
+// returns the identity it contains.
+func verifyIdentity(jwt, consumerToken, consumerSecret, issuer, nonce string, now time.Time) (*OAuthIdentity, error) {
+	parts := strings.Split(strings.TrimSpace(jwt), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid identity JWT: %q", jwt)
+	}
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity JWT header: %v", err)
+	}
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(header, &h); err != nil {
+		return nil, fmt.Errorf("invalid identity JWT header: %v", err)
+	}
+	if h.Alg != "HS256" {
+		return nil, fmt.Errorf("unsupported identity JWT algorithm: %q", h.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity JWT signature: %v", err)
+	}
+	mac := hmac.New(sha256.New, []byte(consumerSecret))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, errors.New("identity JWT signature mismatch")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity JWT payload: %v", err)
+	}
+	var id OAuthIdentity
+	if err := json.Unmarshal(payload, &id); err != nil {
+		return nil, fmt.Errorf("invalid identity JWT payload: %v", err)
+	}
+
+	switch {
+	case id.Issuer != issuer:
+		return nil, fmt.Errorf("identity JWT issuer mismatch: %q != %q", id.Issuer, issuer)
+	case id.Audience != consumerToken:
+		return nil, fmt.Errorf("identity JWT audience mismatch: %q != %q", id.Audience, consumerToken)
+	case id.Nonce != nonce:
+		return nil, errors.New("identity JWT nonce mismatch")
+	case time.Unix(id.IssuedAt, 0).After(now.Add(identityLeeway)):
+		return nil, errors.New("identity JWT issued in the future")
+	case time.Unix(id.ExpiresAt, 0).Before(now.Add(-identityLeeway)):
+		return nil, errors.New("identity JWT expired")
+	}
+	return &id, nil
+}
+
+// tokenRequest makes a signed request to the special page title and parses
+// the token and secret from the response.
+func (f *OAuthFlow) tokenRequest(ctx context.Context, title string, token OAuthToken, oauthParams map[string]string) (OAuthToken, error) {
+	body, _, err := f.signedRequest(ctx, title, token, oauthParams)
+	if err != nil {
+		return OAuthToken{}, err
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil || values.Get("oauth_token") == "" {
+		return OAuthToken{}, fmt.Errorf("%s: unexpected response: %s", title, body)
+	}
+	return OAuthToken{
+		Token:  values.Get("oauth_token"),
+		Secret: values.Get("oauth_token_secret"),
+	}, nil
+}
+
+// signedRequest makes a GET request to the special page title, signed with
+// the consumer credentials, the token and the additional OAuth parameters
+// in oauthParams, and returns the response body and the nonce of the
+// request.
+//
+// The requests are signed by an oauth.Consumer's HTTP client rather than
+// with GetRequestTokenAndUrl and AuthorizeToken, which sign the URL
+// including its query string. MediaWiki requires the title parameter to be
+// signed as a request parameter, which the HTTP client does.
+func (f *OAuthFlow) signedRequest(ctx context.Context, title string, token OAuthToken, oauthParams map[string]string) ([]byte, string, error) {
+	u := *f.indexURL
+	q := u.Query()
+	q.Set("title", title)
+	u.RawQuery = q.Encode()
+
+	consumer := oauth.NewConsumer(f.consumerToken, f.consumerSecret, oauth.ServiceProvider{})
+	consumer.AdditionalParams = oauthParams
+	rec := &nonceRecorder{httpc: f.httpc}
+	consumer.HttpClient = rec
+	httpc, err := consumer.MakeHttpClient(&oauth.AccessToken{Token: token.Token, Secret: token.Secret})
+	if err != nil {
+		return nil, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to create HTTP request: %v", err)
+	}
+	req.Header.Set("User-Agent", f.w.UserAgent)
+
+	resp, err := httpc.Do(req)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, "", ctxErr
+		}
+		return nil, "", fmt.Errorf("error occured during HTTP request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("%s: HTTP %s: %s", title, resp.Status, body)
+	}
+	return body, rec.nonce, nil
+}
+
+// nonceRecorder is an oauth.HttpClient that sends requests with httpc and
+// records the OAuth nonce from their Authorization header, which the
+// identity JWT returned by Special:OAuth/identify must contain.
+type nonceRecorder struct {
+	httpc *http.Client
+	nonce string
+}
+
+func (r *nonceRecorder) Do(req *http.Request) (*http.Response, error) {
+	auth := strings.TrimPrefix(req.Header.Get("Authorization"), "OAuth ")
+	for _, param := range strings.Split(auth, ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(param), "="); ok && k == "oauth_nonce" {
+			r.nonce, _ = url.QueryUnescape(strings.Trim(v, `"`))
+		}
+	}
+	return r.httpc.Do(req)
+}
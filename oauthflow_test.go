@@ -0,0 +1,237 @@
+package mwclient
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// oauthSignature computes the HMAC-SHA1 signature of an OAuth 1.0a
+// request as specified in RFC 5849, section 3.4. It is used by the fake
+// server in TestOAuthFlow to verify the signatures made by the client,
+// independently of the oauth package. The query parameters of u are
+// included in the signature base string.
+func oauthSignature(method string, u *url.URL, oauthParams map[string]string, consumerSecret, tokenSecret string) string {
+	escape := func(s string) string {
+		return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+	}
+	var pairs []string
+	for k, vs := range u.Query() {
+		for _, v := range vs {
+			pairs = append(pairs, escape(k)+"="+escape(v))
+		}
+	}
+	for k, v := range oauthParams {
+		if k != "oauth_signature" {
+			pairs = append(pairs, escape(k)+"="+escape(v))
+		}
+	}
+	sort.Strings(pairs)
+
+	baseURL := strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host) + u.EscapedPath()
+	base := strings.ToUpper(method) + "&" + escape(baseURL) + "&" + escape(strings.Join(pairs, "&"))
+
+	mac := hmac.New(sha1.New, []byte(escape(consumerSecret)+"&"+escape(tokenSecret)))
+	mac.Write([]byte(base))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestOAuthSignature(t *testing.T) {
+	// Example from Appendix A.5 of the OAuth Core 1.0 specification.
+	u, err := url.Parse("http://photos.example.net/photos?file=vacation.jpg&size=original")
+	if err != nil {
+		panic(err)
+	}
+	oauthParams := map[string]string{
+		"oauth_consumer_key":     "dpf43f3p2l4k3l03",
+		"oauth_token":            "nnch734d00sl2jdk",
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        "1191242096",
+		"oauth_nonce":            "kllo9940pd9333jh",
+		"oauth_version":          "1.0",
+	}
+
+	sig := oauthSignature("GET", u, oauthParams, "kd94hf93k423kf44", "pfkkdhi9sl3r4s00")
+	if sig != "tR3+Ty81lMeYAr/Fid0kMTYa/WM=" {
+		t.Fatalf("unexpected signature: %s", sig)
+	}
+}
+
+// parseOAuthHeader parses the parameters of an OAuth Authorization header.
+func parseOAuthHeader(t *testing.T, header string) map[string]string {
+	if !strings.HasPrefix(header, "OAuth ") {
+		t.Fatalf("not an OAuth Authorization header: %q", header)
+	}
+	oauthParams := make(map[string]string)
+	for _, pair := range strings.Split(strings.TrimPrefix(header, "OAuth "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		k, _ := url.QueryUnescape(kv[0])
+		v, _ := url.QueryUnescape(strings.Trim(kv[1], `"`))
+		oauthParams[k] = v
+	}
+	return oauthParams
+}
+
+func makeJWT(claims map[string]interface{}, secret string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"HS256"}`))
+	payloadBytes, err := json.Marshal(claims)
+	if err != nil {
+		panic(err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(payloadBytes)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(header + "." + payload))
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestOAuthFlow(t *testing.T) {
+	const consumerKey, consumerSecret = "CONSUMERKEY", "CONSUMERSECRET"
+	var serverURL string
+
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/index.php" {
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+		oauthParams := parseOAuthHeader(t, r.Header.Get("Authorization"))
+		if oauthParams["oauth_consumer_key"] != consumerKey {
+			t.Errorf("unexpected consumer key: %s", oauthParams["oauth_consumer_key"])
+		}
+
+		var tokenSecret string
+		switch oauthParams["oauth_token"] {
+		case "REQUESTTOKEN":
+			tokenSecret = "REQUESTSECRET"
+		case "ACCESSTOKEN":
+			tokenSecret = "ACCESSSECRET"
+		}
+		u := *r.URL
+		u.Scheme, u.Host = "http", r.Host
+		if sig := oauthSignature(r.Method, &u, oauthParams, consumerSecret, tokenSecret); sig != oauthParams["oauth_signature"] {
+			t.Errorf("%s: bad signature: %s != %s", r.URL.Query().Get("title"), oauthParams["oauth_signature"], sig)
+		}
+
+		switch r.URL.Query().Get("title") {
+		case "Special:OAuth/initiate":
+			if v := oauthParams["oauth_callback"]; v != "oob" {
+				t.Errorf("oauth_callback != oob: oauth_callback=%s", v)
+			}
+			fmt.Fprint(w, "oauth_token=REQUESTTOKEN&oauth_token_secret=REQUESTSECRET&oauth_callback_confirmed=true")
+		case "Special:OAuth/token":
+			if v := oauthParams["oauth_verifier"]; v != "VERIFIER" {
+				t.Errorf("oauth_verifier != VERIFIER: oauth_verifier=%s", v)
+			}
+			fmt.Fprint(w, "oauth_token=ACCESSTOKEN&oauth_token_secret=ACCESSSECRET")
+		case "Special:OAuth/identify":
+			now := time.Now().Unix()
+			fmt.Fprint(w, makeJWT(map[string]interface{}{
+				"iss":      serverURL,
+				"sub":      "12345",
+				"aud":      consumerKey,
+				"exp":      now + 100,
+				"iat":      now,
+				"nonce":    oauthParams["oauth_nonce"],
+				"username": "Example",
+				"groups":   []string{"*", "user"},
+			}, consumerSecret))
+		default:
+			t.Fatalf("unexpected request: %s", r.URL)
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+	serverURL = server.URL
+
+	f, err := client.NewOAuthFlow(server.URL+"/index.php", consumerKey, consumerSecret)
+	if err != nil {
+		t.Fatalf("NewOAuthFlow() returned err: %v", err)
+	}
+
+	if _, err := f.Identify(); err != ErrOAuthNotAuthorized {
+		t.Errorf("expected ErrOAuthNotAuthorized from Identify before Complete, got %v", err)
+	}
+
+	authURL, err := f.Initiate()
+	if err != nil {
+		t.Fatalf("Initiate() returned err: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("invalid authorization URL: %v", err)
+	}
+	if q := u.Query(); q.Get("title") != "Special:OAuth/authorize" ||
+		q.Get("oauth_token") != "REQUESTTOKEN" || q.Get("oauth_consumer_key") != consumerKey {
+		t.Errorf("unexpected authorization URL: %s", authURL)
+	}
+
+	token, err := f.Complete("VERIFIER")
+	if err != nil {
+		t.Fatalf("Complete() returned err: %v", err)
+	}
+	if token != (OAuthToken{"ACCESSTOKEN", "ACCESSSECRET"}) {
+		t.Errorf("unexpected access token: %+v", token)
+	}
+
+	id, err := f.Identify()
+	if err != nil {
+		t.Fatalf("Identify() returned err: %v", err)
+	}
+	if id.Username != "Example" || id.Subject != "12345" || len(id.Groups) != 2 {
+		t.Errorf("unexpected identity: %+v", id)
+	}
+}
+
+func TestVerifyIdentityRejectsBadJWT(t *testing.T) {
+	now := time.Now()
+	claims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   "https://wiki.example",
+			"aud":   "KEY",
+			"exp":   now.Unix() + 100,
+			"iat":   now.Unix(),
+			"nonce": "NONCE",
+		}
+	}
+
+	if _, err := verifyIdentity(makeJWT(claims(), "SECRET"), "KEY", "SECRET", "https://wiki.example", "NONCE", now); err != nil {
+		t.Fatalf("valid JWT rejected: %v", err)
+	}
+
+	tests := map[string]func() string{
+		"signature": func() string { return makeJWT(claims(), "WRONG") },
+		"issuer": func() string {
+			c := claims()
+			c["iss"] = "https://evil.example"
+			return makeJWT(c, "SECRET")
+		},
+		"audience": func() string {
+			c := claims()
+			c["aud"] = "OTHER"
+			return makeJWT(c, "SECRET")
+		},
+		"nonce": func() string {
+			c := claims()
+			c["nonce"] = "REPLAYED"
+			return makeJWT(c, "SECRET")
+		},
+		"expired": func() string {
+			c := claims()
+			c["exp"] = now.Add(-time.Hour).Unix()
+			return makeJWT(c, "SECRET")
+		},
+	}
+	for name, jwt := range tests {
+		if _, err := verifyIdentity(jwt(), "KEY", "SECRET", "https://wiki.example", "NONCE", now); err == nil {
+			t.Errorf("%s: invalid JWT accepted", name)
+		}
+	}
+}
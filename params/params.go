@@ -12,6 +12,7 @@ package params // import "cgt.name/pkg/go-mwclient/params"
 
 import (
 	"bytes"
+	"io"
 	"mime/multipart"
 	"net/url"
 	"sort"
@@ -117,7 +118,67 @@ func (v Values) EncodeMultipart() (data string, contentType string, err error) {
 
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
+	if err := v.WriteMultipart(writer); err != nil {
+		return "", "", err
+	}
+	writer.Close()
+
+	return body.String(), writer.FormDataContentType(), nil
+}
+
+// EncodeMultipartStream is like EncodeMultipart, but instead of building
+// the whole body in memory, it returns a reader from which the body is
+// read as it is being encoded. The files are written as file parts after
+// the other parameters and before the token, as with WriteMultipart.
+//
+// The body must be closed. Close stops the encoding if the body has not
+// been read until EOF and waits until the files are no longer being read.
+// Errors from reading the files are returned by the body's Read method.
+func (v Values) EncodeMultipartStream(files ...File) (body io.ReadCloser, contentType string) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	stream := &multipartStream{PipeReader: pr, done: make(chan struct{})}
+	go func() {
+		defer close(stream.done)
+		err := v.WriteMultipart(writer, files...)
+		if err == nil {
+			err = writer.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return stream, writer.FormDataContentType()
+}
+
+// multipartStream is the body returned by EncodeMultipartStream.
+type multipartStream struct {
+	*io.PipeReader
+	done chan struct{} // closed when the encoding goroutine returns
+}
+
+func (s *multipartStream) Close() error {
+	err := s.PipeReader.Close()
+	<-s.done
+	return err
+}
 
+// File is a file to be sent as a file part of a multipart/form-data
+// request, such as the file parameter of action=upload.
+type File struct {
+	// Key is the name of the parameter, e.g. "file" or "chunk".
+	Key string
+	// Name is the file name sent with the file part.
+	Name string
+	// Content is read until EOF to obtain the content of the file.
+	Content io.Reader
+}
+
+// WriteMultipart writes the parameters to writer as form fields, followed
+// by the files as file parts. Like Encode, it writes the parameters sorted
+// by key, except for the "token" parameter, which is written last (after
+// the files). The content of the files is copied to writer as it is read,
+// so it is never held in memory as a whole.
+// WriteMultipart does not close writer.
+func (v Values) WriteMultipart(writer *multipart.Writer, files ...File) error {
 	var token bool
 
 	keys := v.sortKeys()
@@ -129,23 +190,35 @@ func (v Values) EncodeMultipart() (data string, contentType string, err error) {
 		if v[paramName] != "" {
 			part, err := writer.CreateFormField(paramName)
 			if err != nil {
-				return "", "", err
+				return err
+			}
+			if _, err := part.Write([]byte(v[paramName])); err != nil {
+				return err
 			}
-			part.Write([]byte(v[paramName]))
+		}
+	}
+
+	for _, f := range files {
+		part, err := writer.CreateFormFile(f.Key, f.Name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, f.Content); err != nil {
+			return err
 		}
 	}
 
 	if token {
 		part, err := writer.CreateFormField("token")
 		if err != nil {
-			return "", "", err
+			return err
+		}
+		if _, err := part.Write([]byte(v["token"])); err != nil {
+			return err
 		}
-		part.Write([]byte(v["token"]))
 	}
 
-	writer.Close()
-
-	return body.String(), writer.FormDataContentType(), nil
+	return nil
 }
 
 // sortKeys sorts the keys of the parameters
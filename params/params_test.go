@@ -5,8 +5,12 @@
 package params
 
 import (
+	"errors"
+	"io"
+	"mime/multipart"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 type EncodeQueryTest struct {
@@ -45,6 +49,74 @@ func TestEncodeMultipartQuery(t *testing.T) {
 	}
 }
 
+func TestWriteMultipartFiles(t *testing.T) {
+	var body strings.Builder
+	writer := multipart.NewWriter(&body)
+	v := Values{"action": "upload", "token": "t"}
+	err := v.WriteMultipart(writer, File{Key: "file", Name: "Example.txt", Content: strings.NewReader("file content")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+
+	want := "--!BOUNDARY!\r\nContent-Disposition: form-data; name=\"action\"\r\n\r\nupload\r\n" +
+		"--!BOUNDARY!\r\nContent-Disposition: form-data; name=\"file\"; filename=\"Example.txt\"\r\n" +
+		"Content-Type: application/octet-stream\r\n\r\nfile content\r\n" +
+		"--!BOUNDARY!\r\nContent-Disposition: form-data; name=\"token\"\r\n\r\nt\r\n" +
+		"--!BOUNDARY!--\r\n"
+	want = strings.ReplaceAll(want, "!BOUNDARY!", writer.Boundary())
+	if body.String() != want {
+		t.Errorf("WriteMultipart = %q, want %q", body.String(), want)
+	}
+}
+
+func TestEncodeMultipartStream(t *testing.T) {
+	for _, tt := range encodeQueryTests {
+		if tt.m == nil {
+			continue
+		}
+		body, ctype := tt.m.EncodeMultipartStream()
+		enc, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body.Close()
+		valid := strings.ReplaceAll(tt.multipart, "!BOUNDARY!", strings.TrimPrefix(ctype, "multipart/form-data; boundary="))
+
+		if string(enc) != valid {
+			t.Errorf(`EncodeMultipartStream(%+v) = %q, want %q`, tt.m, enc, valid)
+		}
+	}
+}
+
+func TestEncodeMultipartStreamFileError(t *testing.T) {
+	readErr := errors.New("read error")
+	v := Values{"action": "upload", "token": "t"}
+	body, _ := v.EncodeMultipartStream(File{Key: "file", Name: "Example.txt", Content: iotest.ErrReader(readErr)})
+	defer body.Close()
+	if _, err := io.ReadAll(body); err != readErr {
+		t.Errorf("reading body returned %v, want %v", err, readErr)
+	}
+}
+
+func TestEncodeMultipartStreamClose(t *testing.T) {
+	v := Values{"action": "upload", "token": "t"}
+	content := strings.NewReader(strings.Repeat("x", 1<<20))
+	body, _ := v.EncodeMultipartStream(File{Key: "file", Name: "Example.txt", Content: content})
+	if _, err := body.Read(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	// Close must stop the encoding before the file has been read entirely
+	// and wait until it is no longer being read.
+	body.Close()
+	if content.Len() == 0 {
+		t.Error("file was read entirely after the body was closed")
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestQueryValues(t *testing.T) {
 	v := Values{
 		"foo": "bar",
@@ -1,7 +1,12 @@
 package mwclient
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"iter"
+	"sort"
 
 	"github.com/antonholmquist/jason"
 
@@ -40,10 +45,27 @@ import (
 // See https://www.mediawiki.org/wiki/API:Query for more details on how to
 // query the MediaWiki API.
 type Query struct {
-	w      *Client
-	params params.Values
-	resp   *jason.Object
-	err    error
+	w          *Client
+	ctx        context.Context
+	params     params.Values
+	resp       *jason.Object
+	err        error
+	mergePages bool
+}
+
+// SetMergePages turns page merging on or off for the Query (default off).
+//
+// When a generator is combined with props (for example
+// generator=categorymembers&prop=revisions|categories), the API may
+// spread the data for a single page over several responses, until it
+// signals that the batch of pages is complete (batchcomplete).
+// With page merging turned on, Next keeps requesting results until the
+// batch is complete and merges the partial page objects by page ID, so that
+// each page appears exactly once, with all of its data, in the response made
+// available through Resp. Array values (e.g. "revisions" or "categories")
+// from the partial page objects are concatenated.
+func (q *Query) SetMergePages(on bool) {
+	q.mergePages = on
 }
 
 // Err returns the first error encountered by the Next method.
@@ -59,11 +81,19 @@ func (q *Query) Resp() *jason.Object {
 // NewQuery instantiates a new query with the given parameters.
 // Automatically sets action=query and continue= on the provided params.Values.
 func (w *Client) NewQuery(p params.Values) *Query {
+	return w.NewQueryContext(context.Background(), p)
+}
+
+// NewQueryContext is like NewQuery, but every request made by the returned
+// Query's Next method is bound to ctx. Once ctx is done, Next returns false
+// and Err returns ctx.Err().
+func (w *Client) NewQueryContext(ctx context.Context, p params.Values) *Query {
 	p.Set("action", "query")
 	p.Set("continue", "")
 
 	return &Query{
 		w:      w,
+		ctx:    ctx,
 		params: p,
 		resp:   nil,
 		err:    nil,
@@ -75,9 +105,17 @@ func (w *Client) NewQuery(p params.Values) *Query {
 // through Resp or false if there were no more results to request or if an
 // error occurred.
 func (q *Query) Next() (done bool) {
+	if q.mergePages {
+		return q.nextMerged()
+	}
+	return q.next()
+}
+
+// next retrieves the next single response from the API.
+func (q *Query) next() bool {
 	if q.resp == nil {
 		// first call to Next
-		q.resp, q.err = q.w.Get(q.params)
+		q.resp, q.err = q.w.GetContext(q.ctx, q.params)
 		return q.err == nil
 	}
 
@@ -95,6 +133,278 @@ func (q *Query) Next() (done bool) {
 		q.params.Set(k, value)
 	}
 
-	q.resp, q.err = q.w.Get(q.params)
+	q.resp, q.err = q.w.GetContext(q.ctx, q.params)
 	return q.err == nil
 }
+
+// nextMerged retrieves responses from the API until a complete batch of pages
+// has been received and makes the merged batch available through Resp.
+func (q *Query) nextMerged() bool {
+	var m pageMerger
+	for q.next() {
+		if err := m.add(q.resp); err != nil {
+			q.err = fmt.Errorf("response processing error: %v", err)
+			return false
+		}
+		_, cerr := q.resp.GetValue("continue")
+		_, berr := q.resp.GetValue("batchcomplete")
+		if berr == nil || cerr != nil {
+			// Either the batch is complete, or there is nothing more to
+			// request in which case the batch is complete as well.
+			resp, err := m.result()
+			if err != nil {
+				q.err = fmt.Errorf("response processing error: %v", err)
+				return false
+			}
+			q.resp = resp
+			return true
+		}
+	}
+	return false
+}
+
+// pageMerger merges the partial page objects of several query responses.
+// It supports both formatversion=2 (query.pages is an array) and
+// formatversion=1 (query.pages is an object keyed by page ID).
+type pageMerger struct {
+	// last is the most recent response added to the pageMerger.
+	// Its "continue" object is needed to request further results.
+	last map[string]interface{}
+	// query contains the merged query object, except for pages.
+	query map[string]interface{}
+	// pages contains the merged page objects in order of first appearance.
+	pages []map[string]interface{}
+	// keys contains the key of each page object in pages.
+	keys []string
+	// index maps page keys to indexes in pages.
+	index map[string]int
+	// pagesAsObject is true if the responses used formatversion=1.
+	pagesAsObject bool
+}
+
+// add merges a response into the pageMerger.
+func (m *pageMerger) add(resp *jason.Object) error {
+	raw, err := resp.Marshal()
+	if err != nil {
+		return err
+	}
+	var r map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	if err := d.Decode(&r); err != nil {
+		return err
+	}
+	m.last = r
+	if m.index == nil {
+		m.index = make(map[string]int)
+		m.query = make(map[string]interface{})
+	}
+
+	query, _ := r["query"].(map[string]interface{})
+	for k, v := range query {
+		if k != "pages" {
+			m.query[k] = mergeValues(m.query[k], v)
+		}
+	}
+
+	switch pages := query["pages"].(type) {
+	case []interface{}:
+		for _, v := range pages {
+			page, ok := v.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("unexpected page object: %v", v)
+			}
+			m.addPage(pageKey(page), page)
+		}
+	case map[string]interface{}:
+		m.pagesAsObject = true
+		keys := make([]string, 0, len(pages))
+		for k := range pages {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			page, ok := pages[k].(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("unexpected page object: %v", pages[k])
+			}
+			m.addPage(k, page)
+		}
+	}
+
+	return nil
+}
+
+func (m *pageMerger) addPage(key string, page map[string]interface{}) {
+	if i, ok := m.index[key]; ok {
+		m.pages[i] = mergeValues(m.pages[i], page).(map[string]interface{})
+		return
+	}
+	m.index[key] = len(m.pages)
+	m.pages = append(m.pages, page)
+	m.keys = append(m.keys, key)
+}
+
+// result returns the most recently added response with its query object
+// replaced by the merged query object.
+func (m *pageMerger) result() (*jason.Object, error) {
+	if m.pagesAsObject {
+		pages := make(map[string]interface{}, len(m.pages))
+		for i, page := range m.pages {
+			pages[m.keys[i]] = page
+		}
+		m.query["pages"] = pages
+	} else if len(m.pages) > 0 {
+		pages := make([]interface{}, len(m.pages))
+		for i, page := range m.pages {
+			pages[i] = page
+		}
+		m.query["pages"] = pages
+	}
+	if len(m.query) > 0 {
+		m.last["query"] = m.query
+	}
+
+	raw, err := json.Marshal(m.last)
+	if err != nil {
+		return nil, err
+	}
+	return jason.NewObjectFromBytes(raw)
+}
+
+// pageKey returns a key identifying a page object within a batch.
+// Pages that do not exist have no page ID, so they are identified by title.
+func pageKey(page map[string]interface{}) string {
+	if id, ok := page["pageid"]; ok {
+		return fmt.Sprint("id:", id)
+	}
+	return fmt.Sprint("title:", page["title"])
+}
+
+// mergeValues merges src into dst and returns the result.
+// Arrays are concatenated, objects are merged recursively, and other values
+// in src replace those in dst.
+func mergeValues(dst, src interface{}) interface{} {
+	switch s := src.(type) {
+	case []interface{}:
+		if d, ok := dst.([]interface{}); ok {
+			return append(d, s...)
+		}
+	case map[string]interface{}:
+		if d, ok := dst.(map[string]interface{}); ok {
+			for k, v := range s {
+				d[k] = mergeValues(d[k], v)
+			}
+			return d
+		}
+	}
+	return src
+}
+
+// TypedQuery is like Query, but decodes each set of results into a value
+// of type T using encoding/json, so that callers can describe the parts of
+// the response they are interested in with a struct instead of traversing
+// a *jason.Object.
+//
+// A TypedQuery should be instantiated through the NewTypedQuery function.
+// It can be used with Next, Resp and Err just like a Query, or iterated
+// over with a range loop through the All method:
+//
+//	type categoryMembers struct {
+//		Query struct {
+//			CategoryMembers []struct {
+//				PageID int    `json:"pageid"`
+//				Title  string `json:"title"`
+//			} `json:"categorymembers"`
+//		} `json:"query"`
+//	}
+//
+//	q := mwclient.NewTypedQuery[categoryMembers](w, params.Values{
+//		"list":    "categorymembers",
+//		"cmtitle": "Category:Soap",
+//	})
+//	for resp, err := range q.All() {
+//		if err != nil {
+//			// handle the error
+//		}
+//		for _, m := range resp.Query.CategoryMembers {
+//			fmt.Println(m.Title)
+//		}
+//	}
+type TypedQuery[T any] struct {
+	q    *Query
+	resp T
+	err  error
+}
+
+// NewTypedQuery instantiates a new TypedQuery with the given parameters.
+// Like NewQuery, it automatically sets action=query and continue= on the
+// provided params.Values.
+func NewTypedQuery[T any](w *Client, p params.Values) *TypedQuery[T] {
+	return NewTypedQueryContext[T](context.Background(), w, p)
+}
+
+// NewTypedQueryContext is like NewTypedQuery, but every request made by the
+// returned TypedQuery is bound to ctx.
+func NewTypedQueryContext[T any](ctx context.Context, w *Client, p params.Values) *TypedQuery[T] {
+	return &TypedQuery[T]{q: w.NewQueryContext(ctx, p)}
+}
+
+// SetMergePages turns page merging on or off for the TypedQuery.
+// See Query.SetMergePages.
+func (q *TypedQuery[T]) SetMergePages(on bool) {
+	q.q.SetMergePages(on)
+}
+
+// Err returns the first error encountered by the Next method.
+func (q *TypedQuery[T]) Err() error {
+	if q.err != nil {
+		return q.err
+	}
+	return q.q.Err()
+}
+
+// Resp returns the decoded API response retrieved by the Next method.
+func (q *TypedQuery[T]) Resp() T {
+	return q.resp
+}
+
+// Next retrieves the next set of results from the API, decodes them into
+// a new value of type T and makes it available through the Resp method.
+// Next returns true if new results are available through Resp or false if
+// there were no more results to request or if an error occurred.
+func (q *TypedQuery[T]) Next() bool {
+	if q.err != nil || !q.q.Next() {
+		return false
+	}
+
+	raw, err := q.q.Resp().Marshal()
+	if err != nil {
+		q.err = fmt.Errorf("response processing error: %v", err)
+		return false
+	}
+	var resp T
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		q.err = fmt.Errorf("response processing error: %v", err)
+		return false
+	}
+	q.resp = resp
+	return true
+}
+
+// All returns an iterator over the remaining sets of results of the query.
+// If an error occurs, it is yielded along with the zero value of T as the
+// last element of the sequence.
+func (q *TypedQuery[T]) All() iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for q.Next() {
+			if !yield(q.resp, nil) {
+				return
+			}
+		}
+		if err := q.Err(); err != nil {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package mwclient
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"testing"
 
+	"github.com/antonholmquist/jason"
+
 	"cgt.name/pkg/go-mwclient/params"
 )
 
@@ -51,3 +54,168 @@ func TestQuery(t *testing.T) {
 		t.Fatalf("q.Err() != nil: %v", err)
 	}
 }
+
+func TestQueryContextCanceled(t *testing.T) {
+	queryHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"continue":{"fkcontinue":"sendthisback","continue":"-||"}}`)
+	}
+
+	server, client := setup(queryHandler)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := client.NewQueryContext(ctx, params.Values{})
+	if !q.Next() {
+		t.Fatalf("first call to Next() failed: %v", q.Err())
+	}
+	cancel()
+	if q.Next() {
+		t.Fatalf("Next() returned true after context was canceled")
+	}
+	if err := q.Err(); err != context.Canceled {
+		t.Fatalf("Expected context.Canceled from q.Err(), got: %v", err)
+	}
+}
+
+func TestTypedQuery(t *testing.T) {
+	type result struct {
+		Query struct {
+			CategoryMembers []struct {
+				PageID int    `json:"pageid"`
+				Title  string `json:"title"`
+			} `json:"categorymembers"`
+		} `json:"query"`
+	}
+
+	reqCount := 0
+	queryHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		switch reqCount {
+		case 0:
+			fmt.Fprint(w, `{"continue":{"cmcontinue":"page|2","continue":"-||"},
+			"query":{"categorymembers":[{"pageid":1,"ns":0,"title":"A"}]}}`)
+		case 1:
+			if v := r.Form.Get("cmcontinue"); v != "page|2" {
+				t.Fatalf("client did not return cmcontinue parameter: cmcontinue=%s", v)
+			}
+			fmt.Fprint(w, `{"batchcomplete":true,
+			"query":{"categorymembers":[{"pageid":2,"ns":0,"title":"B"}]}}`)
+		default:
+			t.Fatalf("unexpected request #%d", reqCount)
+		}
+		reqCount++
+	}
+
+	server, client := setup(queryHandler)
+	defer server.Close()
+
+	q := NewTypedQuery[result](client, params.Values{"list": "categorymembers"})
+	var titles []string
+	for resp, err := range q.All() {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, m := range resp.Query.CategoryMembers {
+			titles = append(titles, m.Title)
+		}
+	}
+	if len(titles) != 2 || titles[0] != "A" || titles[1] != "B" {
+		t.Fatalf("unexpected titles: %v", titles)
+	}
+}
+
+func TestTypedQueryYieldsError(t *testing.T) {
+	queryHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"error":{"code":"badvalue","info":"Bad value."}}`)
+	}
+
+	server, client := setup(queryHandler)
+	defer server.Close()
+
+	q := NewTypedQuery[struct{}](client, params.Values{})
+	var errs []error
+	for _, err := range q.All() {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("expected exactly 1 element, got %d", len(errs))
+	}
+	if e, ok := errs[0].(APIError); !ok || e.Code != "badvalue" {
+		t.Fatalf("expected badvalue APIError, got %#v", errs[0])
+	}
+}
+
+func TestQueryMergePages(t *testing.T) {
+	responses := []string{
+		`{"continue":{"rvcontinue":"1|2","continue":"gcmcontinue||"},
+		"query":{"pages":[
+			{"pageid":1,"ns":0,"title":"A","revisions":[{"revid":10}]},
+			{"pageid":2,"ns":0,"title":"B"}]}}`,
+		`{"continue":{"clcontinue":"2|X","continue":"gcmcontinue||revisions"},
+		"query":{"pages":[
+			{"pageid":1,"ns":0,"title":"A","categories":[{"title":"Category:X"}]},
+			{"pageid":2,"ns":0,"title":"B","revisions":[{"revid":20}]}]}}`,
+		`{"batchcomplete":true,"continue":{"gcmcontinue":"page|C","continue":"gcmcontinue||"},
+		"query":{"pages":[
+			{"pageid":1,"ns":0,"title":"A"},
+			{"pageid":2,"ns":0,"title":"B","categories":[{"title":"Category:X"}]}]}}`,
+		`{"batchcomplete":true,
+		"query":{"pages":[
+			{"pageid":3,"ns":0,"title":"C","revisions":[{"revid":30}]}]}}`,
+	}
+	reqCount := 0
+	queryHandler := func(w http.ResponseWriter, r *http.Request) {
+		if reqCount >= len(responses) {
+			t.Fatalf("unexpected request #%d", reqCount)
+		}
+		fmt.Fprint(w, responses[reqCount])
+		reqCount++
+	}
+
+	server, client := setup(queryHandler)
+	defer server.Close()
+
+	q := client.NewQuery(params.Values{
+		"generator": "categorymembers",
+		"prop":      "revisions|categories",
+	})
+	q.SetMergePages(true)
+
+	var batches [][]*jason.Object
+	for q.Next() {
+		pages, err := q.Resp().GetObjectArray("query", "pages")
+		if err != nil {
+			t.Fatalf("unable to get pages: %v", err)
+		}
+		batches = append(batches, pages)
+	}
+	if err := q.Err(); err != nil {
+		t.Fatalf("q.Err() != nil: %v", err)
+	}
+
+	if len(batches) != 2 {
+		t.Fatalf("expected 2 batches, got %d", len(batches))
+	}
+	if len(batches[0]) != 2 || len(batches[1]) != 1 {
+		t.Fatalf("unexpected number of pages in batches: %d, %d",
+			len(batches[0]), len(batches[1]))
+	}
+	for _, page := range batches[0] {
+		title, _ := page.GetString("title")
+		revs, err := page.GetObjectArray("revisions")
+		if err != nil || len(revs) != 1 {
+			t.Errorf("page %s: expected 1 revision, got %v (err: %v)", title, revs, err)
+		}
+		cats, err := page.GetObjectArray("categories")
+		if err != nil || len(cats) != 1 {
+			t.Errorf("page %s: expected 1 category, got %v (err: %v)", title, cats, err)
+		}
+	}
+	if title, _ := batches[1][0].GetString("title"); title != "C" {
+		t.Errorf("expected page C in second batch, got %s", title)
+	}
+}
@@ -0,0 +1,106 @@
+package mwclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// RateLimit specifies a client-side limit on the rate of API requests:
+// at most Requests requests per Per. Requests may be made in bursts of up
+// to Requests requests, as long as the average rate stays within the limit.
+// The zero value means no limit.
+//
+// For example, RateLimit{Requests: 1, Per: 10 * time.Second} allows one
+// request every ten seconds.
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// SetRateLimits configures client-side rate limits for read and write
+// requests made by the Client. Write requests are requests that carry
+// a token parameter (such as edits); all other requests are read requests.
+// The limits are shared by all goroutines using the Client, and include
+// retried requests. Waiting for the rate limit is aborted if the request's
+// context is done. To remove a limit, pass the zero RateLimit.
+func (w *Client) SetRateLimits(reads, writes RateLimit) {
+	w.readLimiter = newRateLimiter(reads)
+	w.writeLimiter = newRateLimiter(writes)
+}
+
+// waitRateLimit blocks until the request with the parameters p is allowed
+// by the Client's rate limits, or until ctx is done.
+func (w *Client) waitRateLimit(ctx context.Context, p params.Values) error {
+	l := w.readLimiter
+	if isWriteRequest(p) {
+		l = w.writeLimiter
+	}
+	return l.wait(ctx)
+}
+
+// isWriteRequest reports whether p are the parameters of a write request.
+func isWriteRequest(p params.Values) bool {
+	_, ok := p["token"]
+	return ok
+}
+
+// rateLimiter implements RateLimit using the generic cell rate algorithm.
+// A nil *rateLimiter allows every request immediately.
+type rateLimiter struct {
+	// interval is the average time between requests.
+	interval time.Duration
+	// tolerance is how far ahead of the average rate requests may be made.
+	tolerance time.Duration
+	// sleep and now are used for mocking in tests.
+	sleep sleeper
+	now   func() time.Time
+
+	mu sync.Mutex
+	// tat is the theoretical arrival time of the next request.
+	tat time.Time
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	if limit.Requests <= 0 || limit.Per <= 0 {
+		return nil
+	}
+	interval := limit.Per / time.Duration(limit.Requests)
+	return &rateLimiter{
+		interval:  interval,
+		tolerance: interval * time.Duration(limit.Requests-1),
+		sleep:     sleepContext,
+		now:       time.Now,
+	}
+}
+
+// wait blocks until a request is allowed or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	start := l.tat
+	if start.Before(now) {
+		start = now
+	}
+	delay := start.Sub(now) - l.tolerance
+	l.tat = start.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	if err := l.sleep(ctx, delay); err != nil {
+		// The request will not be made, so give back its slot.
+		l.mu.Lock()
+		l.tat = l.tat.Add(-l.interval)
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package mwclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// fakeClock is a clock for rate limiter tests that only advances when
+// something sleeps.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	return nil
+}
+
+func TestRateLimiter(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	l := newRateLimiter(RateLimit{Requests: 2, Per: 10 * time.Second})
+	l.now, l.sleep = clock.Now, clock.Sleep
+
+	start := clock.Now()
+	var elapsed []time.Duration
+	for i := 0; i < 5; i++ {
+		if err := l.wait(context.Background()); err != nil {
+			t.Fatalf("wait() returned err: %v", err)
+		}
+		elapsed = append(elapsed, clock.Now().Sub(start))
+	}
+
+	// A burst of 2, then one request every 5 seconds.
+	expected := "[0s 0s 5s 10s 15s]"
+	if fmt.Sprint(elapsed) != expected {
+		t.Errorf("unexpected request times: %v, expected %s", elapsed, expected)
+	}
+}
+
+func TestRateLimiterCanceled(t *testing.T) {
+	l := newRateLimiter(RateLimit{Requests: 1, Per: time.Hour})
+	if err := l.wait(context.Background()); err != nil {
+		t.Fatalf("first wait() returned err: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded from wait(), got %v", err)
+	}
+	if tat := l.tat.Sub(time.Now()); tat > time.Hour {
+		t.Errorf("canceled wait() did not give back its slot: next request in %v", tat)
+	}
+}
+
+func TestRateLimitsSeparateReadsAndWrites(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+	client.SetRateLimits(RateLimit{Requests: 50, Per: time.Second}, RateLimit{Requests: 1, Per: time.Hour})
+
+	// Reads are not held up by the write limit.
+	for i := 0; i < 10; i++ {
+		if _, err := client.Get(params.Values{"action": "query"}); err != nil {
+			t.Fatalf("Get() returned err: %v", err)
+		}
+	}
+
+	if _, err := client.Post(params.Values{"action": "purge", "token": "+\\"}); err != nil {
+		t.Fatalf("first Post() returned err: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := client.PostContext(ctx, params.Values{"action": "purge", "token": "+\\"})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected second write to be rate limited, got %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package mwclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// RetryPolicy decides whether and when failed requests are retried.
+// See Client.RetryPolicy.
+type RetryPolicy interface {
+	// RetryDelay is called after each failed attempt at a request.
+	// It returns whether the request should be retried and, if so,
+	// how long to wait before the next attempt.
+	// RetryDelay must be safe for concurrent use.
+	RetryDelay(a Attempt) (delay time.Duration, retry bool)
+}
+
+// Attempt describes a failed attempt at a request.
+type Attempt struct {
+	// Number is the number of the attempt, starting at 1.
+	Number int
+	// Params contains the parameters of the request.
+	// They must not be modified.
+	Params params.Values
+	// Write is true if the request is a write request, i.e. it carries
+	// a token. Write requests may have had effects even if they failed.
+	Write bool
+	// Err is the reason the attempt failed. It is an APIError if the API
+	// returned an error (for maxlag errors, the code is "maxlag"),
+	// an HTTPError if the server responded with an HTTP error status,
+	// or some other error if the HTTP request itself failed.
+	Err error
+	// RetryAfter is the delay requested by the server in the Retry-After
+	// header, or zero if there was none.
+	RetryAfter time.Duration
+}
+
+// RetryClass classifies failed requests according to whether it is safe to
+// retry them.
+type RetryClass int
+
+// These consts are the possible RetryClasses.
+const (
+	// NoRetry means that the request must not be retried.
+	NoRetry RetryClass = iota
+	// RetryReads means that the request may be retried if it is a read
+	// request. Write requests are not retried, because the failed attempt
+	// may have had effects (e.g. the edit may have been saved even though
+	// the server timed out).
+	RetryReads
+	// RetryAll means that the request was rejected before it had any
+	// effect and may be retried even if it is a write request.
+	RetryAll
+)
+
+// ClassifyError returns the default RetryClass for the error of a failed
+// attempt (see Attempt.Err).
+//
+// The API errors maxlag, ratelimited and readonly, and HTTP status 429
+// are classified as RetryAll. Database errors reported by the API
+// (internal_api_error_DBQueryError, internal_api_error_DBQueryTimeoutError
+// and internal_api_error_DBConnectionError), HTTP status 500, 502, 503 and
+// 504, and network errors are classified as RetryReads.
+// All other errors are classified as NoRetry.
+func ClassifyError(err error) RetryClass {
+	switch e := err.(type) {
+	case nil:
+		return NoRetry
+	case APIError:
+		switch e.Code {
+		case "maxlag", "ratelimited", "readonly":
+			return RetryAll
+		case "internal_api_error_DBQueryError",
+			"internal_api_error_DBQueryTimeoutError",
+			"internal_api_error_DBConnectionError":
+			return RetryReads
+		}
+		return NoRetry
+	case APIWarnings, CaptchaError:
+		return NoRetry
+	case HTTPError:
+		switch e.StatusCode {
+		case http.StatusTooManyRequests:
+			return RetryAll
+		case http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return RetryReads
+		}
+		return NoRetry
+	}
+	if isContextError(err) {
+		return NoRetry
+	}
+	return RetryReads
+}
+
+// BackoffPolicy is a RetryPolicy that retries requests with exponential
+// backoff and jitter. The delay before attempt n+1 is chosen randomly
+// between half of and the full value of BaseDelay * 2^(n-1), capped at
+// MaxDelay. If the server requested a longer delay with Retry-After,
+// that delay is used instead.
+//
+// Errors are classified with ClassifyError unless their API error code
+// is in Codes.
+//
+// For example, the following configures a Client to make up to 5 attempts
+// at each request, and to also retry read requests that fail with the
+// "internal_api_error_MWException" error:
+//
+//	w.RetryPolicy = mwclient.BackoffPolicy{
+//		MaxAttempts: 5,
+//		BaseDelay:   time.Second,
+//		MaxDelay:    time.Minute,
+//		Codes: map[string]mwclient.RetryClass{
+//			"internal_api_error_MWException": mwclient.RetryReads,
+//		},
+//	}
+type BackoffPolicy struct {
+	// MaxAttempts is the maximum number of attempts at a request,
+	// including the first one.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts, except for delays
+	// requested by the server. Zero means no cap.
+	MaxDelay time.Duration
+	// Codes overrides the classification of API error codes.
+	Codes map[string]RetryClass
+}
+
+// RetryDelay implements RetryPolicy.
+func (b BackoffPolicy) RetryDelay(a Attempt) (time.Duration, bool) {
+	if a.Number >= b.MaxAttempts {
+		return 0, false
+	}
+
+	class := ClassifyError(a.Err)
+	if apierr, ok := a.Err.(APIError); ok {
+		if c, ok := b.Codes[apierr.Code]; ok {
+			class = c
+		}
+	}
+	switch class {
+	case NoRetry:
+		return 0, false
+	case RetryReads:
+		if a.Write {
+			return 0, false
+		}
+	}
+
+	delay := b.BaseDelay
+	for i := 1; i < a.Number && (b.MaxDelay == 0 || delay < b.MaxDelay); i++ {
+		delay *= 2
+	}
+	if b.MaxDelay > 0 && delay > b.MaxDelay {
+		delay = b.MaxDelay
+	}
+	if delay > 0 {
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+	if a.RetryAfter > delay {
+		delay = a.RetryAfter
+	}
+	return delay, true
+}
+
+// parseRetryAfter parses the Retry-After header, which may contain either
+// a number of seconds or an HTTP date. It returns zero if the header is
+// missing or invalid.
+func parseRetryAfter(header http.Header) time.Duration {
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// peekAPIError returns the API error contained in the response body,
+// or nil if there is none. The error member need not come first: the API
+// may put warnings or other members before it.
+func peekAPIError(body []byte) error {
+	if !bytes.Contains(body, []byte(`"error"`)) {
+		return nil
+	}
+	var resp struct {
+		Error *APIError `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Error == nil {
+		return nil
+	}
+	return *resp.Error
+}
@@ -0,0 +1,239 @@
+package mwclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// recordSleep returns a sleeper that records the requested delays.
+func recordSleep(delays *[]time.Duration) sleeper {
+	return func(ctx context.Context, d time.Duration) error {
+		*delays = append(*delays, d)
+		return nil
+	}
+}
+
+func TestRetryReadOnServerError(t *testing.T) {
+	var calls int32
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":"","query":{}}`)
+	})
+	defer server.Close()
+	client.RetryPolicy = BackoffPolicy{MaxAttempts: 3, BaseDelay: time.Second}
+
+	if _, err := client.Get(params.Values{"action": "query"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 requests, got %d", calls)
+	}
+}
+
+func TestRetryWriteNotRetriedOnServerError(t *testing.T) {
+	var calls int32
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer server.Close()
+	client.RetryPolicy = BackoffPolicy{MaxAttempts: 3, BaseDelay: time.Second}
+
+	_, err := client.Post(params.Values{"action": "edit", "token": "+\\"})
+	var httpErr HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected HTTPError 503, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 request, got %d", calls)
+	}
+}
+
+func TestRetryWriteOnRateLimited(t *testing.T) {
+	var calls int32
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			fmt.Fprint(w, `{"error":{"code":"ratelimited","info":"You've exceeded your rate limit."}}`)
+			return
+		}
+		fmt.Fprint(w, `{"edit":{"result":"Success"}}`)
+	})
+	defer server.Close()
+	client.RetryPolicy = BackoffPolicy{MaxAttempts: 3, BaseDelay: time.Second}
+
+	if _, err := client.Post(params.Values{"action": "edit", "token": "+\\"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 requests, got %d", calls)
+	}
+}
+
+func TestRetryRateLimitedAfterWarnings(t *testing.T) {
+	var calls int32
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			fmt.Fprint(w, `{"warnings":{"main":{"warnings":"Unrecognized parameter: foo."}},`+
+				`"error":{"code":"ratelimited","info":"You've exceeded your rate limit."}}`)
+			return
+		}
+		fmt.Fprint(w, `{"edit":{"result":"Success"}}`)
+	})
+	defer server.Close()
+	client.RetryPolicy = BackoffPolicy{MaxAttempts: 3, BaseDelay: time.Second}
+
+	if _, err := client.Post(params.Values{"action": "edit", "token": "+\\"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 requests, got %d", calls)
+	}
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	var calls int32
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		fmt.Fprint(w, `{"error":{"code":"internal_api_error_DBQueryTimeoutError","info":"timeout"}}`)
+	})
+	defer server.Close()
+	client.RetryPolicy = BackoffPolicy{MaxAttempts: 4, BaseDelay: time.Second}
+
+	_, err := client.Get(params.Values{"action": "query"})
+	if apiErr, ok := err.(APIError); !ok || apiErr.Code != "internal_api_error_DBQueryTimeoutError" {
+		t.Fatalf("expected DBQueryTimeoutError, got %v", err)
+	}
+	if calls != 4 {
+		t.Errorf("expected 4 requests, got %d", calls)
+	}
+}
+
+func TestRetryNoRetryForOtherErrors(t *testing.T) {
+	var calls int32
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		fmt.Fprint(w, `{"error":{"code":"badvalue","info":"bad value"}}`)
+	})
+	defer server.Close()
+	client.RetryPolicy = BackoffPolicy{MaxAttempts: 4, BaseDelay: time.Second}
+
+	if _, err := client.Get(params.Values{"action": "query"}); err == nil {
+		t.Fatal("expected error")
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 request, got %d", calls)
+	}
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	var calls int32
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"edit":{"result":"Success"}}`)
+	})
+	defer server.Close()
+	var delays []time.Duration
+	client.sleep = recordSleep(&delays)
+	client.RetryPolicy = BackoffPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	if _, err := client.Post(params.Values{"action": "edit", "token": "+\\"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(delays) != 1 || delays[0] != 120*time.Second {
+		t.Errorf("expected a single delay of 120s, got %v", delays)
+	}
+}
+
+func TestRetryMaxlagUsesMaxlagConfig(t *testing.T) {
+	var calls int32
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("X-Database-Lag", "10")
+		w.Header().Set("Retry-After", "5")
+		fmt.Fprint(w, `{"error":{"code":"maxlag","info":"Waiting for a database server"}}`)
+	})
+	defer server.Close()
+	client.Maxlag.On = true
+	client.RetryPolicy = BackoffPolicy{MaxAttempts: 10, BaseDelay: time.Second}
+
+	if _, err := client.Get(params.Values{"action": "query"}); err != ErrAPIBusy {
+		t.Fatalf("expected ErrAPIBusy, got %v", err)
+	}
+	if int(calls) != client.Maxlag.Retries {
+		t.Errorf("expected %d requests, got %d", client.Maxlag.Retries, calls)
+	}
+}
+
+func TestBackoffPolicyDelay(t *testing.T) {
+	b := BackoffPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	err := HTTPError{StatusCode: http.StatusBadGateway}
+	for n, max := range []time.Duration{1, 2, 4, 5, 5} {
+		max *= time.Second
+		delay, retry := b.RetryDelay(Attempt{Number: n + 1, Err: err})
+		if !retry {
+			t.Fatalf("attempt %d: expected retry", n+1)
+		}
+		if delay < max/2 || delay > max {
+			t.Errorf("attempt %d: delay %v not in [%v, %v]", n+1, delay, max/2, max)
+		}
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want RetryClass
+	}{
+		{APIError{Code: "maxlag"}, RetryAll},
+		{APIError{Code: "ratelimited"}, RetryAll},
+		{APIError{Code: "readonly"}, RetryAll},
+		{APIError{Code: "internal_api_error_DBQueryTimeoutError"}, RetryReads},
+		{APIError{Code: "badtoken"}, NoRetry},
+		{HTTPError{StatusCode: http.StatusTooManyRequests}, RetryAll},
+		{HTTPError{StatusCode: http.StatusGatewayTimeout}, RetryReads},
+		{HTTPError{StatusCode: http.StatusNotFound}, NoRetry},
+		{errors.New("connection reset by peer"), RetryReads},
+		{context.Canceled, NoRetry},
+	}
+	for _, test := range tests {
+		if got := ClassifyError(test.err); got != test.want {
+			t.Errorf("ClassifyError(%v) = %d, want %d", test.err, got, test.want)
+		}
+	}
+}
+
+func TestHTTPErrorRetryAfter(t *testing.T) {
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	defer server.Close()
+
+	_, err := client.Get(params.Values{"action": "query"})
+	var httpErr HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("expected HTTPError, got %v", err)
+	}
+	if httpErr.RetryAfter != 7*time.Second {
+		t.Errorf("RetryAfter = %v, want 7s", httpErr.RetryAfter)
+	}
+	// HTTPError must remain comparable so that comparing errors with ==
+	// does not panic.
+	if err == ErrAPIBusy {
+		t.Error("HTTPError compared equal to ErrAPIBusy")
+	}
+}
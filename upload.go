@@ -0,0 +1,382 @@
+package mwclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/antonholmquist/jason"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// DefaultUploadChunkSize is the default size of the chunks in which Upload
+// uploads large files.
+const DefaultUploadChunkSize = 5 << 20 // 5 MiB
+
+// UploadOptions contains options for Upload.
+// See https://www.mediawiki.org/wiki/API:Upload
+type UploadOptions struct {
+	// Comment is the upload summary.
+	Comment string
+	// Text is the initial content of the file description page if the
+	// file is new.
+	Text string
+	// IgnoreWarnings makes the upload succeed despite warnings, e.g. if
+	// a file with the same name already exists. If it is false, uploads
+	// with warnings fail with an UploadWarningError.
+	IgnoreWarnings bool
+	// ChunkSize is the size of the chunks in which files are uploaded if
+	// they are larger than ChunkSize. If it is zero, DefaultUploadChunkSize
+	// is used.
+	ChunkSize int
+	// Size is the size of the file in bytes, which the API requires for
+	// chunked uploads. If it is zero, Upload uses the number of bytes
+	// remaining in the reader, which it can determine if the reader is an
+	// *os.File, implements Len() int (like *bytes.Reader) or implements
+	// io.Seeker. Other readers require Size to be set for files larger
+	// than ChunkSize and for resumed uploads.
+	Size int64
+	// FileKey and Offset resume a chunked upload that failed with an
+	// UploadChunkError. The reader passed to Upload must read the file from
+	// the start; Upload skips the first Offset bytes.
+	FileKey string
+	Offset  int64
+}
+
+var errUploadSize = errors.New("unable to determine the size of the file to upload: set UploadOptions.Size")
+
+// UploadResult contains the information returned by the API about
+// a successful upload.
+type UploadResult struct {
+	Filename  string
+	ImageInfo ImageInfo
+}
+
+// ImageInfo contains information about an uploaded file.
+type ImageInfo struct {
+	Timestamp      string `json:"timestamp"`
+	User           string `json:"user"`
+	Size           int    `json:"size"`
+	Width          int    `json:"width"`
+	Height         int    `json:"height"`
+	SHA1           string `json:"sha1"`
+	MIME           string `json:"mime"`
+	URL            string `json:"url"`
+	DescriptionURL string `json:"descriptionurl"`
+}
+
+// UploadWarningError is returned by Upload when the API refuses an upload
+// because of warnings and UploadOptions.IgnoreWarnings is false.
+// The file has been stored in the user's upload stash; to publish it
+// anyway, pass FileKey to UploadStashed with IgnoreWarnings set.
+type UploadWarningError struct {
+	FileKey string
+	// Warnings maps warning names (e.g. "exists", "duplicate",
+	// "was-deleted") to the raw JSON values of the warnings.
+	Warnings map[string]json.RawMessage
+}
+
+func (e UploadWarningError) Error() string {
+	names := make([]string, 0, len(e.Warnings))
+	for name := range e.Warnings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("upload warnings: %s", strings.Join(names, ", "))
+}
+
+// Exists returns the name of the existing file that the upload would
+// overwrite, or "" if there is none.
+func (e UploadWarningError) Exists() string {
+	return e.stringWarning("exists")
+}
+
+// WasDeleted returns the name of the file if a file with the same name was
+// deleted before, or "" otherwise.
+func (e UploadWarningError) WasDeleted() string {
+	return e.stringWarning("was-deleted")
+}
+
+// Duplicates returns the names of existing files with the same content as
+// the uploaded file.
+func (e UploadWarningError) Duplicates() []string {
+	var names []string
+	json.Unmarshal(e.Warnings["duplicate"], &names)
+	return names
+}
+
+func (e UploadWarningError) stringWarning(name string) string {
+	var s string
+	json.Unmarshal(e.Warnings[name], &s)
+	return s
+}
+
+// UploadChunkError is returned by Upload when uploading a chunk of a file
+// failed. The upload can be resumed by calling Upload again with
+// UploadOptions.FileKey and UploadOptions.Offset set to FileKey and Offset.
+type UploadChunkError struct {
+	FileKey string
+	Offset  int64
+	Err     error
+}
+
+func (e UploadChunkError) Error() string {
+	return fmt.Sprintf("unable to upload chunk at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e UploadChunkError) Unwrap() error { return e.Err }
+
+// uploadResponse is the upload object of an action=upload response.
+type uploadResponse struct {
+	Result    string                     `json:"result"`
+	FileKey   string                     `json:"filekey"`
+	Offset    int64                      `json:"offset"`
+	Filename  string                     `json:"filename"`
+	Warnings  map[string]json.RawMessage `json:"warnings"`
+	ImageInfo ImageInfo                  `json:"imageinfo"`
+}
+
+// Upload uploads the file read from r under the name filename.
+//
+// Files larger than the chunk size (see UploadOptions.ChunkSize) are
+// uploaded in chunks to the user's upload stash and then published.
+// Each chunk is held in memory while it is uploaded.
+// If uploading a chunk fails, Upload returns an UploadChunkError, which
+// contains the information needed to resume the upload.
+//
+// If the API refuses the upload because of warnings, Upload returns
+// an UploadWarningError.
+func (w *Client) Upload(filename string, r io.Reader, opts UploadOptions) (*UploadResult, error) {
+	return w.UploadContext(context.Background(), filename, r, opts)
+}
+
+// UploadContext is like Upload, but the requests are bound to ctx.
+func (w *Client) UploadContext(ctx context.Context, filename string, r io.Reader, opts UploadOptions) (*UploadResult, error) {
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultUploadChunkSize
+	}
+	size := opts.Size
+	if size == 0 {
+		size = readerSize(r)
+	}
+	if size == 0 && opts.FileKey != "" {
+		return nil, errUploadSize
+	}
+
+	token, err := w.GetTokenContext(ctx, CSRFToken)
+	if err != nil {
+		return nil, fmt.Errorf("unable to obtain csrf token: %s", err)
+	}
+
+	if opts.FileKey != "" {
+		if err := skip(r, opts.Offset); err != nil {
+			return nil, fmt.Errorf("unable to resume upload: %v", err)
+		}
+		filekey, err := w.uploadChunks(ctx, filename, token, r, size, chunkSize, opts.FileKey, opts.Offset)
+		if err != nil {
+			return nil, err
+		}
+		return w.UploadStashedContext(ctx, filename, filekey, opts)
+	}
+
+	// Read one byte more than a chunk, so that a file of exactly chunkSize
+	// bytes is recognized as fitting into a single chunk even if its size
+	// is unknown.
+	chunk := make([]byte, chunkSize+1)
+	n, err := io.ReadFull(r, chunk)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// The file fits into a single chunk.
+		p := uploadParams(filename, opts)
+		p["token"] = token
+		file := params.File{Key: "file", Name: filename, Content: bytes.NewReader(chunk[:n])}
+		return w.upload(ctx, p, file)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if size == 0 {
+		return nil, errUploadSize
+	}
+	r = io.MultiReader(bytes.NewReader(chunk), r)
+	filekey, err := w.uploadChunks(ctx, filename, token, r, size, chunkSize, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	return w.UploadStashedContext(ctx, filename, filekey, opts)
+}
+
+// UploadStashed publishes a file from the user's upload stash under the
+// name filename. filekey identifies the file in the stash (see
+// UploadWarningError). opts.ChunkSize, opts.Size, opts.FileKey and
+// opts.Offset are ignored.
+func (w *Client) UploadStashed(filename, filekey string, opts UploadOptions) (*UploadResult, error) {
+	return w.UploadStashedContext(context.Background(), filename, filekey, opts)
+}
+
+// UploadStashedContext is like UploadStashed, but the requests are bound
+// to ctx.
+func (w *Client) UploadStashedContext(ctx context.Context, filename, filekey string, opts UploadOptions) (*UploadResult, error) {
+	token, err := w.GetTokenContext(ctx, CSRFToken)
+	if err != nil {
+		return nil, fmt.Errorf("unable to obtain csrf token: %s", err)
+	}
+	p := uploadParams(filename, opts)
+	p["filekey"] = filekey
+	p["token"] = token
+	return w.upload(ctx, p)
+}
+
+// uploadParams returns the parameters for publishing an upload.
+func uploadParams(filename string, opts UploadOptions) params.Values {
+	p := params.Values{
+		"action":   "upload",
+		"filename": filename,
+	}
+	if opts.Comment != "" {
+		p["comment"] = opts.Comment
+	}
+	if opts.Text != "" {
+		p["text"] = opts.Text
+	}
+	if opts.IgnoreWarnings {
+		p["ignorewarnings"] = "1"
+	}
+	return p
+}
+
+// upload makes an upload request that publishes a file.
+func (w *Client) upload(ctx context.Context, p params.Values, files ...params.File) (*UploadResult, error) {
+	js, err := w.callJSONFiles(ctx, p, true, files)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := decodeUploadResponse(js)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.Result {
+	case "Success":
+		return &UploadResult{Filename: resp.Filename, ImageInfo: resp.ImageInfo}, nil
+	case "Warning":
+		return nil, UploadWarningError{FileKey: resp.FileKey, Warnings: resp.Warnings}
+	}
+	return nil, fmt.Errorf("unrecognized upload result: %s", resp.Result)
+}
+
+// uploadChunks uploads the file read from r to the upload stash in chunks,
+// starting at offset, and returns the file key of the stashed file.
+// If filekey is not empty, the chunks are appended to the stashed file
+// with that key.
+func (w *Client) uploadChunks(ctx context.Context, filename, token string, r io.Reader, size int64, chunkSize int, filekey string, offset int64) (string, error) {
+	chunk := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if err == io.EOF {
+			return "", UploadChunkError{filekey, offset,
+				errors.New("reached the end of the file, but the API did not report the upload as complete")}
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			return "", UploadChunkError{filekey, offset, err}
+		}
+
+		p := params.Values{
+			"action":   "upload",
+			"stash":    "1",
+			"filename": filename,
+			"filesize": strconv.FormatInt(size, 10),
+			"offset":   strconv.FormatInt(offset, 10),
+			"token":    token,
+		}
+		if filekey != "" {
+			p["filekey"] = filekey
+		}
+		file := params.File{Key: "chunk", Name: filename, Content: bytes.NewReader(chunk[:n])}
+		js, err := w.callJSONFiles(ctx, p, true, []params.File{file})
+		if err != nil {
+			return "", UploadChunkError{filekey, offset, err}
+		}
+		resp, err := decodeUploadResponse(js)
+		if err != nil {
+			return "", UploadChunkError{filekey, offset, err}
+		}
+
+		switch resp.Result {
+		case "Continue":
+			filekey = resp.FileKey
+			offset = resp.Offset
+		case "Success":
+			return resp.FileKey, nil
+		case "Warning":
+			return "", UploadWarningError{FileKey: resp.FileKey, Warnings: resp.Warnings}
+		default:
+			return "", UploadChunkError{filekey, offset, fmt.Errorf("unrecognized upload result: %s", resp.Result)}
+		}
+	}
+}
+
+func decodeUploadResponse(js *jason.Object) (*uploadResponse, error) {
+	upload, err := js.GetObject("upload")
+	if err != nil {
+		return nil, fmt.Errorf("invalid API response: %v", err)
+	}
+	uploadBytes, err := upload.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("error occured while decoding upload result: %s", err)
+	}
+	var resp uploadResponse
+	if err := json.Unmarshal(uploadBytes, &resp); err != nil {
+		return nil, fmt.Errorf("error occured while decoding upload result: %s", err)
+	}
+	return &resp, nil
+}
+
+// readerSize returns the number of bytes remaining in r,
+// or 0 if it cannot be determined.
+func readerSize(r io.Reader) int64 {
+	switch r := r.(type) {
+	case *os.File:
+		info, err := r.Stat()
+		if err != nil {
+			return 0
+		}
+		pos, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0
+		}
+		return info.Size() - pos
+	case interface{ Len() int }: // *bytes.Reader, *strings.Reader
+		return int64(r.Len())
+	case io.Seeker:
+		pos, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0
+		}
+		end, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0
+		}
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return 0
+		}
+		return end - pos
+	}
+	return 0
+}
+
+// skip discards the next n bytes of r.
+func skip(r io.Reader, n int64) error {
+	if seeker, ok := r.(io.Seeker); ok {
+		_, err := seeker.Seek(n, io.SeekCurrent)
+		return err
+	}
+	_, err := io.CopyN(io.Discard, r, n)
+	return err
+}
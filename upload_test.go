@@ -0,0 +1,256 @@
+package mwclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// parseUpload parses an upload request and returns the content of the file
+// part with the given key, or "" if there is none.
+func parseUpload(t *testing.T, r *http.Request, key string) string {
+	if r.Method != "POST" {
+		t.Fatalf("upload requests must be posted. Method: %v", r.Method)
+	}
+	if err := r.ParseMultipartForm(1 << 20); err != nil && err != http.ErrNotMultipart {
+		t.Fatalf("unable to parse upload request: %v", err)
+	}
+	if v := r.Form.Get("token"); v != "VALIDTOKEN" {
+		t.Fatalf("token != VALIDTOKEN: token=%s", v)
+	}
+	f, _, err := r.FormFile(key)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("unable to read file part: %v", err)
+	}
+	return string(b)
+}
+
+func TestUpload(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		content := parseUpload(t, r, "file")
+		if content != "GIF89a" {
+			t.Errorf("file content = %q, want %q", content, "GIF89a")
+		}
+		if v := r.Form.Get("filename"); v != "Example.gif" {
+			t.Errorf("filename = %q", v)
+		}
+		if v := r.Form.Get("comment"); v != "summary" {
+			t.Errorf("comment = %q", v)
+		}
+		if v := r.Form.Get("ignorewarnings"); v != "1" {
+			t.Errorf("ignorewarnings = %q", v)
+		}
+		fmt.Fprint(w, `{"upload":{"result":"Success","filename":"Example.gif",
+		"imageinfo":{"size":6,"sha1":"abc","mime":"image/gif"}}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	res, err := client.Upload("Example.gif", strings.NewReader("GIF89a"), UploadOptions{
+		Comment:        "summary",
+		IgnoreWarnings: true,
+	})
+	if err != nil {
+		t.Fatalf("upload returned error: %v", err)
+	}
+	if res.Filename != "Example.gif" || res.ImageInfo.Size != 6 || res.ImageInfo.MIME != "image/gif" {
+		t.Errorf("unexpected result: %+v", res)
+	}
+}
+
+func TestUploadWarnings(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		parseUpload(t, r, "file")
+		if _, ok := r.Form["ignorewarnings"]; ok {
+			t.Errorf("ignorewarnings sent")
+		}
+		fmt.Fprint(w, `{"upload":{"result":"Warning","filekey":"abc.gif",
+		"warnings":{"exists":"Example.gif","duplicate":["Other.gif"]}}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	_, err := client.Upload("Example.gif", strings.NewReader("GIF89a"), UploadOptions{})
+	var warnErr UploadWarningError
+	if !errors.As(err, &warnErr) {
+		t.Fatalf("expected UploadWarningError, got %v", err)
+	}
+	if warnErr.FileKey != "abc.gif" {
+		t.Errorf("FileKey = %q", warnErr.FileKey)
+	}
+	if v := warnErr.Exists(); v != "Example.gif" {
+		t.Errorf("Exists() = %q", v)
+	}
+	if v := warnErr.Duplicates(); len(v) != 1 || v[0] != "Other.gif" {
+		t.Errorf("Duplicates() = %v", v)
+	}
+	if v := warnErr.Error(); v != "upload warnings: duplicate, exists" {
+		t.Errorf("Error() = %q", v)
+	}
+}
+
+// chunkedUploadServer returns a handler for chunked uploads that stores the
+// received chunks in *got. If failAt is not negative, the chunk at that
+// offset fails once with an API error.
+func chunkedUploadServer(t *testing.T, got *string, failAt int) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chunk := parseUpload(t, r, "chunk")
+		if r.Form.Get("stash") == "" {
+			// Publishing the stashed file.
+			if v := r.Form.Get("filekey"); v != "key.txt" {
+				t.Errorf("publish: filekey = %q", v)
+			}
+			if v := r.Form.Get("text"); v != "description" {
+				t.Errorf("publish: text = %q", v)
+			}
+			fmt.Fprint(w, `{"upload":{"result":"Success","filename":"Example.txt","imageinfo":{"size":10}}}`)
+			return
+		}
+
+		if v := r.Form.Get("filesize"); v != "10" {
+			t.Errorf("filesize = %q", v)
+		}
+		offset, _ := strconv.Atoi(r.Form.Get("offset"))
+		if offset != len(*got) {
+			t.Errorf("offset = %d, want %d", offset, len(*got))
+		}
+		if offset > 0 && r.Form.Get("filekey") != "key.txt" {
+			t.Errorf("filekey = %q", r.Form.Get("filekey"))
+		}
+		if offset == failAt {
+			failAt = -1
+			fmt.Fprint(w, `{"error":{"code":"stashfailed","info":"Could not store upload in the stash."}}`)
+			return
+		}
+
+		*got += chunk
+		result := "Continue"
+		if len(*got) == 10 {
+			result = "Success"
+		}
+		fmt.Fprintf(w, `{"upload":{"result":%q,"filekey":"key.txt","offset":%d}}`, result, len(*got))
+	}
+}
+
+func TestUploadChunked(t *testing.T) {
+	var got string
+	server, client := setup(chunkedUploadServer(t, &got, -1))
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	res, err := client.Upload("Example.txt", strings.NewReader("0123456789"), UploadOptions{
+		Text:      "description",
+		ChunkSize: 4,
+	})
+	if err != nil {
+		t.Fatalf("upload returned error: %v", err)
+	}
+	if got != "0123456789" {
+		t.Errorf("uploaded content = %q", got)
+	}
+	if res.Filename != "Example.txt" || res.ImageInfo.Size != 10 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+}
+
+func TestUploadChunkedUnknownSize(t *testing.T) {
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("unexpected request")
+	})
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	r := io.MultiReader(strings.NewReader("0123456789"))
+	if _, err := client.Upload("Example.txt", r, UploadOptions{ChunkSize: 4}); err == nil {
+		t.Fatal("expected error for chunked upload of unknown size")
+	}
+}
+
+func TestUploadExactChunkUnknownSize(t *testing.T) {
+	var requests int
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if content := parseUpload(t, r, "file"); content != "0123" {
+			t.Errorf("file content = %q, want %q", content, "0123")
+		}
+		if _, ok := r.Form["filekey"]; ok {
+			t.Errorf("file sent in chunks")
+		}
+		fmt.Fprint(w, `{"upload":{"result":"Success","filename":"Example.txt",
+		"imageinfo":{"size":4}}}`)
+	})
+	defer server.Close()
+
+	// A reader of unknown size holding exactly one chunk is uploaded in a
+	// single request.
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	r := io.MultiReader(strings.NewReader("0123"))
+	if _, err := client.Upload("Example.txt", r, UploadOptions{ChunkSize: 4}); err != nil {
+		t.Fatalf("upload returned error: %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("made %d requests, want 1", requests)
+	}
+}
+
+func TestUploadChunkedResume(t *testing.T) {
+	var got string
+	server, client := setup(chunkedUploadServer(t, &got, 4))
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	opts := UploadOptions{Text: "description", ChunkSize: 4}
+	_, err := client.Upload("Example.txt", strings.NewReader("0123456789"), opts)
+	var chunkErr UploadChunkError
+	if !errors.As(err, &chunkErr) {
+		t.Fatalf("expected UploadChunkError, got %v", err)
+	}
+	if chunkErr.FileKey != "key.txt" || chunkErr.Offset != 4 {
+		t.Errorf("unexpected UploadChunkError: %+v", chunkErr)
+	}
+	var apiErr APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "stashfailed" {
+		t.Errorf("UploadChunkError does not wrap the API error: %v", err)
+	}
+
+	opts.FileKey = chunkErr.FileKey
+	opts.Offset = chunkErr.Offset
+	opts.Size = 10
+	if _, err := client.Upload("Example.txt", io.MultiReader(strings.NewReader("0123456789")), opts); err != nil {
+		t.Fatalf("resumed upload returned error: %v", err)
+	}
+	if got != "0123456789" {
+		t.Errorf("uploaded content = %q", got)
+	}
+}
+
+func TestUploadResumeUnknownSize(t *testing.T) {
+	requests := 0
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	})
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	opts := UploadOptions{ChunkSize: 4, FileKey: "key.txt", Offset: 4}
+	_, err := client.Upload("Example.txt", io.MultiReader(strings.NewReader("0123456789")), opts)
+	if err == nil {
+		t.Fatal("expected error when resuming from a reader of unknown size")
+	}
+	if requests != 0 {
+		t.Errorf("made %d requests, want 0", requests)
+	}
+}
@@ -0,0 +1,309 @@
+package mwclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"maps"
+	"strconv"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// WatchResult describes the result of watching or unwatching a single page.
+type WatchResult struct {
+	Title string `json:"title"`
+	// Watched is true if the page was added to the watchlist.
+	Watched bool `json:"watched"`
+	// Unwatched is true if the page was removed from the watchlist.
+	Unwatched bool `json:"unwatched"`
+	// Expiry is the time at which the page will be removed from the
+	// watchlist, or "infinity". It is empty if the page was unwatched or if
+	// the wiki does not support watchlist expiry.
+	Expiry string `json:"watchlistexpiry"`
+	// Missing is true if the page does not exist. Pages that do not exist
+	// can be watched nonetheless.
+	Missing bool `json:"missing"`
+	// Invalid is true if the title is invalid. Invalid titles cannot be
+	// watched.
+	Invalid bool `json:"invalid"`
+}
+
+// Watch adds the pages with the given titles to the user's watchlist.
+// expiry is the time after which the pages are removed from the watchlist
+// again, either as a timestamp or as a relative time such as "1 month".
+// If expiry is empty, the pages are watched permanently (or, if they are
+// already watched, their expiry is left unchanged).
+// Watchlist expiry requires MediaWiki 1.35 or later.
+//
+// If there are more titles than the API accepts at once, they are watched
+// in several requests.
+// See https://www.mediawiki.org/wiki/API:Watch
+func (w *Client) Watch(titles []string, expiry string) ([]WatchResult, error) {
+	return w.WatchContext(context.Background(), titles, expiry)
+}
+
+// WatchContext is like Watch, but the requests are bound to ctx.
+func (w *Client) WatchContext(ctx context.Context, titles []string, expiry string) ([]WatchResult, error) {
+	p := params.Values{}
+	if expiry != "" {
+		p["expiry"] = expiry
+	}
+	return w.watch(ctx, titles, p)
+}
+
+// Unwatch removes the pages with the given titles from the user's
+// watchlist. See Watch.
+func (w *Client) Unwatch(titles []string) ([]WatchResult, error) {
+	return w.UnwatchContext(context.Background(), titles)
+}
+
+// UnwatchContext is like Unwatch, but the requests are bound to ctx.
+func (w *Client) UnwatchContext(ctx context.Context, titles []string) ([]WatchResult, error) {
+	return w.watch(ctx, titles, params.Values{"unwatch": "1"})
+}
+
+// watch makes action=watch requests for titles in batches with the
+// additional parameters in extra.
+func (w *Client) watch(ctx context.Context, titles []string, extra params.Values) ([]WatchResult, error) {
+	limit := lowMultiValueLimit
+	if len(titles) > lowMultiValueLimit {
+		var err error
+		limit, err = w.multiValueLimit(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to determine API limits: %v", err)
+		}
+	}
+
+	var results []WatchResult
+	for start := 0; start < len(titles); start += limit {
+		end := min(start+limit, len(titles))
+		p := params.Values{"action": "watch"}
+		for k, v := range extra {
+			p[k] = v
+		}
+		p.AddRange("titles", titles[start:end]...)
+
+		var batch []WatchResult
+		if err := w.writeAction(ctx, WatchToken, p, &batch); err != nil {
+			return results, err
+		}
+		results = append(results, batch...)
+	}
+	return results, nil
+}
+
+// WatchlistOptions contains options for Watchlist.
+// See https://www.mediawiki.org/wiki/API:Watchlist
+type WatchlistOptions struct {
+	// Namespaces restricts the changes to pages in the given namespaces.
+	Namespaces []int
+	// Start and End are timestamps limiting the changes to a time range.
+	// Changes are listed from newest to oldest, so Start must be later
+	// than End.
+	Start, End string
+	// Types restricts the changes to the given types: "edit", "new",
+	// "log", "external" or "categorize".
+	Types []string
+	// Show restricts the changes to those matching the given criteria,
+	// e.g. "minor", "!bot" or "unread".
+	Show []string
+	// AllRevisions lists all changes instead of only the latest change
+	// to each page.
+	AllRevisions bool
+	// Owner and Token are used to read the watchlist of another user
+	// (the token is set in that user's preferences). By default, the
+	// logged-in user's watchlist is read.
+	Owner, Token string
+}
+
+// WatchlistEntry is a change to a page on a watchlist.
+type WatchlistEntry struct {
+	// Type is the type of the change: "edit", "new", "log", "external"
+	// or "categorize".
+	Type      string `json:"type"`
+	Namespace int    `json:"ns"`
+	Title     string `json:"title"`
+	PageID    int    `json:"pageid"`
+	RevID     int    `json:"revid"`
+	OldRevID  int    `json:"old_revid"`
+	User      string `json:"user"`
+	Comment   string `json:"comment"`
+	Timestamp string `json:"timestamp"`
+	Minor     bool   `json:"minor"`
+	Bot       bool   `json:"bot"`
+	New       bool   `json:"new"`
+	OldLen    int    `json:"oldlen"`
+	NewLen    int    `json:"newlen"`
+	// Expiry is the time at which the page will be removed from the
+	// watchlist, or "" if it is watched permanently.
+	Expiry string `json:"expiry"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler. The API returns false as the
+// expiry of permanently watched pages.
+func (e *WatchlistEntry) UnmarshalJSON(data []byte) error {
+	type entry WatchlistEntry
+	var v struct {
+		*entry
+		Expiry interface{} `json:"expiry"`
+	}
+	v.entry = (*entry)(e)
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	e.Expiry, _ = v.Expiry.(string)
+	return nil
+}
+
+type watchlistResponse struct {
+	Query struct {
+		Watchlist []WatchlistEntry `json:"watchlist"`
+	} `json:"query"`
+}
+
+// Watchlist returns an iterator over the recent changes to the pages on the
+// user's watchlist, newest first. The changes are requested in batches as
+// the iteration proceeds, and every range over the sequence starts again
+// from the newest change. If an error occurs, it is yielded as the last
+// element of the sequence along with the zero WatchlistEntry.
+//
+//	for entry, err := range w.Watchlist(mwclient.WatchlistOptions{}) {
+//		if err != nil {
+//			// handle the error
+//		}
+//		fmt.Println(entry.Title, entry.User)
+//	}
+func (w *Client) Watchlist(opts WatchlistOptions) iter.Seq2[WatchlistEntry, error] {
+	return w.WatchlistContext(context.Background(), opts)
+}
+
+// WatchlistContext is like Watchlist, but the requests are bound to ctx.
+func (w *Client) WatchlistContext(ctx context.Context, opts WatchlistOptions) iter.Seq2[WatchlistEntry, error] {
+	p := params.Values{
+		"list":    "watchlist",
+		"wlprop":  "ids|title|flags|user|comment|timestamp|sizes|expiry",
+		"wllimit": "max",
+	}
+	if len(opts.Namespaces) > 0 {
+		p.AddRange("wlnamespace", formatInts(opts.Namespaces)...)
+	}
+	if opts.Start != "" {
+		p["wlstart"] = opts.Start
+	}
+	if opts.End != "" {
+		p["wlend"] = opts.End
+	}
+	if len(opts.Types) > 0 {
+		p.AddRange("wltype", opts.Types...)
+	}
+	if len(opts.Show) > 0 {
+		p.AddRange("wlshow", opts.Show...)
+	}
+	if opts.AllRevisions {
+		p["wlallrev"] = "1"
+	}
+	if opts.Owner != "" {
+		p["wlowner"] = opts.Owner
+		p["wltoken"] = opts.Token
+	}
+
+	return func(yield func(WatchlistEntry, error) bool) {
+		// The query adds the continuation parameters to its params.
+		q := NewTypedQueryContext[watchlistResponse](ctx, w, maps.Clone(p))
+		for resp, err := range q.All() {
+			if err != nil {
+				yield(WatchlistEntry{}, err)
+				return
+			}
+			for _, e := range resp.Query.Watchlist {
+				if !yield(e, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// WatchlistRawOptions contains options for WatchlistRaw.
+// See https://www.mediawiki.org/wiki/API:Watchlistraw
+type WatchlistRawOptions struct {
+	// Namespaces restricts the pages to the given namespaces.
+	Namespaces []int
+	// Changed restricts the pages to those that have (if it is "changed")
+	// or have not (if it is "!changed") been changed since the user last
+	// visited them.
+	Changed string
+	// Owner and Token are used to read the watchlist of another user.
+	// See WatchlistOptions.
+	Owner, Token string
+}
+
+// WatchedPage is a page on a watchlist.
+type WatchedPage struct {
+	Namespace int    `json:"ns"`
+	Title     string `json:"title"`
+	// Changed is the time of the first change to the page since the user
+	// last visited it, or "" if the user has seen all changes.
+	Changed string `json:"changed"`
+}
+
+type watchlistRawResponse struct {
+	// The pages are at the top level of the response rather than in the
+	// query object.
+	WatchlistRaw []WatchedPage `json:"watchlistraw"`
+}
+
+// WatchlistRaw returns an iterator over all pages on the user's watchlist,
+// including talk pages. The pages are requested in batches as the
+// iteration proceeds, and every range over the sequence starts again from
+// the first page. If an error occurs, it is yielded as the last element
+// of the sequence along with the zero WatchedPage.
+func (w *Client) WatchlistRaw(opts WatchlistRawOptions) iter.Seq2[WatchedPage, error] {
+	return w.WatchlistRawContext(context.Background(), opts)
+}
+
+// WatchlistRawContext is like WatchlistRaw, but the requests are bound
+// to ctx.
+func (w *Client) WatchlistRawContext(ctx context.Context, opts WatchlistRawOptions) iter.Seq2[WatchedPage, error] {
+	p := params.Values{
+		"list":    "watchlistraw",
+		"wrprop":  "changed",
+		"wrlimit": "max",
+	}
+	if len(opts.Namespaces) > 0 {
+		p.AddRange("wrnamespace", formatInts(opts.Namespaces)...)
+	}
+	if opts.Changed != "" {
+		p["wrshow"] = opts.Changed
+	}
+	if opts.Owner != "" {
+		p["wrowner"] = opts.Owner
+		p["wrtoken"] = opts.Token
+	}
+
+	return func(yield func(WatchedPage, error) bool) {
+		// The query adds the continuation parameters to its params.
+		q := NewTypedQueryContext[watchlistRawResponse](ctx, w, maps.Clone(p))
+		for resp, err := range q.All() {
+			if err != nil {
+				yield(WatchedPage{}, err)
+				return
+			}
+			for _, page := range resp.WatchlistRaw {
+				if !yield(page, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func formatInts(ints []int) []string {
+	s := make([]string, len(ints))
+	for i, n := range ints {
+		s[i] = strconv.Itoa(n)
+	}
+	return s
+}
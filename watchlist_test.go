@@ -0,0 +1,208 @@
+package mwclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWatch(t *testing.T) {
+	var batches []string
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			panic("Bad HTTP form")
+		}
+		if r.Method != "POST" {
+			t.Fatalf("watch requests must be posted. Method: %v", r.Method)
+		}
+		if v := r.Form.Get("token"); v != "WATCHTOKEN" {
+			t.Fatalf("token != WATCHTOKEN: token=%s", v)
+		}
+		if v := r.Form.Get("expiry"); v != "1 month" {
+			t.Errorf("expiry = %q", v)
+		}
+		titles := strings.Split(r.Form.Get("titles"), "|")
+		batches = append(batches, r.Form.Get("titles"))
+		var results []string
+		for _, title := range titles {
+			results = append(results, fmt.Sprintf(`{"ns":0,"title":%q,"watched":true,"watchlistexpiry":"2024-02-01T00:00:00Z"}`, title))
+		}
+		fmt.Fprintf(w, `{"batchcomplete":true,"watch":[%s]}`, strings.Join(results, ","))
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[WatchToken] = "WATCHTOKEN"
+	client.multiValueMax = lowMultiValueLimit
+	var titles []string
+	for i := 0; i < lowMultiValueLimit+10; i++ {
+		titles = append(titles, fmt.Sprintf("Page %d", i))
+	}
+	results, err := client.Watch(titles, "1 month")
+	if err != nil {
+		t.Fatalf("watch returned error: %v", err)
+	}
+	wantBatches := []string{
+		strings.Join(titles[:lowMultiValueLimit], "|"),
+		strings.Join(titles[lowMultiValueLimit:], "|"),
+	}
+	if !reflect.DeepEqual(batches, wantBatches) {
+		t.Errorf("batches = %q, want %q", batches, wantBatches)
+	}
+	if len(results) != len(titles) {
+		t.Fatalf("got %d results, want %d", len(results), len(titles))
+	}
+	want := WatchResult{Title: "Page 59", Watched: true, Expiry: "2024-02-01T00:00:00Z"}
+	if results[len(results)-1] != want {
+		t.Errorf("last result = %+v, want %+v", results[len(results)-1], want)
+	}
+}
+
+func TestUnwatch(t *testing.T) {
+	want := map[string]string{"titles": "A|B", "unwatch": "1", "expiry": ""}
+	resp := `{"batchcomplete":true,"watch":[{"ns":0,"title":"A","unwatched":true},
+	{"ns":0,"title":"B","missing":true,"unwatched":true}]}`
+	server, client := setup(writeActionHandler(t, "watch", want, resp))
+	defer server.Close()
+
+	// Small batches are sent without looking up the user's rights, so the
+	// handler only has to answer the watch request.
+	client.Tokens[WatchToken] = "VALIDTOKEN"
+	results, err := client.Unwatch([]string{"A", "B"})
+	if err != nil {
+		t.Fatalf("unwatch returned error: %v", err)
+	}
+	wantResults := []WatchResult{
+		{Title: "A", Unwatched: true},
+		{Title: "B", Unwatched: true, Missing: true},
+	}
+	if !reflect.DeepEqual(results, wantResults) {
+		t.Errorf("Unwatch = %+v, want %+v", results, wantResults)
+	}
+}
+
+func TestWatchlist(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			panic("Bad HTTP form")
+		}
+		if v := r.Form.Get("list"); v != "watchlist" {
+			t.Fatalf("list != watchlist: list=%s", v)
+		}
+		if v := r.Form.Get("wlnamespace"); v != "0|1" {
+			t.Errorf("wlnamespace = %q", v)
+		}
+		if r.Form.Get("wlcontinue") == "" {
+			fmt.Fprint(w, `{"continue":{"wlcontinue":"20240101000000|2","continue":"-||"},
+			"query":{"watchlist":[{"type":"edit","ns":0,"title":"A","pageid":1,"revid":3,
+			"old_revid":2,"user":"Alice","comment":"fix","timestamp":"2024-01-02T00:00:00Z",
+			"minor":true,"bot":false,"new":false,"oldlen":10,"newlen":12,"expiry":false}]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"watchlist":[{"type":"new","ns":1,
+		"title":"Talk:B","pageid":4,"revid":5,"old_revid":0,"user":"Bob","comment":"",
+		"timestamp":"2024-01-01T00:00:00Z","minor":false,"bot":false,"new":true,
+		"oldlen":0,"newlen":5,"expiry":"2024-03-01T00:00:00Z"}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	seq := client.Watchlist(WatchlistOptions{Namespaces: []int{0, 1}})
+	var entries []WatchlistEntry
+	for entry, err := range seq {
+		if err != nil {
+			t.Fatalf("watchlist returned error: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	want := []WatchlistEntry{
+		{Type: "edit", Namespace: 0, Title: "A", PageID: 1, RevID: 3, OldRevID: 2,
+			User: "Alice", Comment: "fix", Timestamp: "2024-01-02T00:00:00Z",
+			Minor: true, OldLen: 10, NewLen: 12},
+		{Type: "new", Namespace: 1, Title: "Talk:B", PageID: 4, RevID: 5,
+			User: "Bob", Timestamp: "2024-01-01T00:00:00Z", New: true, NewLen: 5,
+			Expiry: "2024-03-01T00:00:00Z"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("Watchlist =\n%+v\nwant\n%+v", entries, want)
+	}
+
+	// Ranging over the sequence again starts from the newest change.
+	var again []WatchlistEntry
+	for entry, err := range seq {
+		if err != nil {
+			t.Fatalf("watchlist returned error: %v", err)
+		}
+		again = append(again, entry)
+	}
+	if !reflect.DeepEqual(again, want) {
+		t.Errorf("second range over Watchlist =\n%+v\nwant\n%+v", again, want)
+	}
+}
+
+func TestWatchlistError(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"error":{"code":"notloggedin","info":"You must be logged in to have a watchlist."}}`)
+	}
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	var n int
+	for _, err := range client.Watchlist(WatchlistOptions{}) {
+		n++
+		var apiErr APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != "notloggedin" {
+			t.Errorf("expected notloggedin APIError, got %v", err)
+		}
+	}
+	if n != 1 {
+		t.Errorf("got %d elements, want 1", n)
+	}
+}
+
+func TestWatchlistRaw(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			panic("Bad HTTP form")
+		}
+		if v := r.Form.Get("list"); v != "watchlistraw" {
+			t.Fatalf("list != watchlistraw: list=%s", v)
+		}
+		if v := r.Form.Get("wrshow"); v != "changed" {
+			t.Errorf("wrshow = %q", v)
+		}
+		if r.Form.Get("wrcontinue") == "" {
+			fmt.Fprint(w, `{"continue":{"wrcontinue":"0|B","continue":"-||"},
+			"watchlistraw":[{"ns":0,"title":"A","changed":"2024-01-01T00:00:00Z"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"watchlistraw":[{"ns":0,"title":"B","changed":"2024-01-02T00:00:00Z"}]}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	// The sequence can be ranged over more than once.
+	seq := client.WatchlistRaw(WatchlistRawOptions{Changed: "changed"})
+	for i := 0; i < 2; i++ {
+		var pages []WatchedPage
+		for page, err := range seq {
+			if err != nil {
+				t.Fatalf("watchlistraw returned error: %v", err)
+			}
+			pages = append(pages, page)
+		}
+		want := []WatchedPage{
+			{Title: "A", Changed: "2024-01-01T00:00:00Z"},
+			{Title: "B", Changed: "2024-01-02T00:00:00Z"},
+		}
+		if !reflect.DeepEqual(pages, want) {
+			t.Errorf("WatchlistRaw (range %d) = %+v, want %+v", i+1, pages, want)
+		}
+	}
+}